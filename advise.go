@@ -0,0 +1,139 @@
+// This file helps programmers decide whether to use symbols or strings.
+
+package intern
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// adviceComp is the maximum number of strings to which each sample string is
+// compared when measuring comparison costs.
+const adviceComp = 100
+
+// adviceMinTime is the minimum duration of each measurement.
+const adviceMinTime = 20 * time.Millisecond
+
+// adviceSink receives the results of measured comparisons so the compiler
+// cannot optimize them away.
+var adviceSink uint64
+
+// Advice reports the costs of using strings, Eqs, and LGEs for a given
+// workload on the current machine and recommends which to use.  All costs are
+// mean times per operation in nanoseconds.
+type Advice struct {
+	StringEqual   float64 // Time to test two strings for equality
+	StringOrder   float64 // Time to test if one string precedes another
+	SymbolCompare float64 // Time to compare two symbols
+	EqAlloc       float64 // Time to allocate an Eq
+	LGEAlloc      float64 // Time to allocate an LGE
+	EqBreakEven   float64 // Comparisons per allocation above which Eqs win
+	LGEBreakEven  float64 // Comparisons per allocation above which LGEs win
+	UseEq         bool    // true if Eqs beat strings for equality tests
+	UseLGE        bool    // true if LGEs beat strings for ordering tests
+}
+
+// measure returns the mean time in nanoseconds per operation of a function
+// that performs a given number of operations.  It runs the function
+// repeatedly until the total time is long enough to measure reliably.
+func measure(nOps int, f func()) float64 {
+	n := 0
+	start := time.Now()
+	for time.Since(start) < adviceMinTime {
+		f()
+		n++
+	}
+	return float64(time.Since(start)) / float64(n*nOps)
+}
+
+// compareAll applies a comparison function to each element of a slice and
+// each of the first adviceComp elements.
+func compareAll[T any](xs []T, cmp func(a, b T) bool) {
+	nc := min(len(xs), adviceComp)
+	for _, x1 := range xs {
+		for _, x2 := range xs[:nc] {
+			if cmp(x1, x2) {
+				adviceSink++
+			}
+		}
+	}
+}
+
+// breakEven returns the number of comparisons per allocation above which
+// paying an allocation cost to make comparisons cheaper saves time overall.
+func breakEven(alloc, strCmp, symCmp float64) float64 {
+	if strCmp <= symCmp {
+		return math.Inf(1)
+	}
+	return alloc / (strCmp - symCmp)
+}
+
+// Advise measures the costs of comparing and interning a sample of strings
+// representative of a program's workload.  Given the number of comparisons
+// the program expects to perform per string it interns, Advise recommends
+// whether to use Eqs in place of strings for equality tests and LGEs in place
+// of strings for ordering tests.  Advise uses private symbol tables, leaving
+// the package's Eq and LGE tables unmodified.  It does not account for the
+// memory the symbol tables consume.
+func Advise(sample []string, ratio float64) Advice {
+	var a Advice
+	if len(sample) == 0 {
+		return a
+	}
+
+	// Measure allocation costs using private tables.
+	var es, ls state
+	eSyms := make([]symbol, len(sample))
+	a.EqAlloc = measure(len(sample), func() {
+		es.forgetAll()
+		for i, s := range sample {
+			eSyms[i], _ = es.assignNext(s, "Eq")
+		}
+	})
+	var lErr error
+	a.LGEAlloc = measure(len(sample), func() {
+		ls.forgetAll()
+		ls.pending = append(ls.pending, sample...)
+		lErr = firstError(ls.flushPending())
+	})
+
+	// Measure comparison costs.
+	n := len(sample) * min(len(sample), adviceComp)
+	a.StringEqual = measure(n, func() {
+		compareAll(sample, func(a, b string) bool { return a == b })
+	})
+	a.StringOrder = measure(n, func() {
+		compareAll(sample, func(a, b string) bool { return a < b })
+	})
+	a.SymbolCompare = measure(n, func() {
+		compareAll(eSyms, func(a, b symbol) bool { return a == b })
+	})
+
+	// Recommend a representation.
+	a.EqBreakEven = breakEven(a.EqAlloc, a.StringEqual, a.SymbolCompare)
+	a.LGEBreakEven = breakEven(a.LGEAlloc, a.StringOrder, a.SymbolCompare)
+	if lErr != nil {
+		a.LGEBreakEven = math.Inf(1)
+	}
+	a.UseEq = ratio > a.EqBreakEven
+	a.UseLGE = ratio > a.LGEBreakEven
+	return a
+}
+
+// String formats Advice as a human-readable report.
+func (a Advice) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "String equality test:   %.3g ns\n", a.StringEqual)
+	fmt.Fprintf(&sb, "String ordering test:   %.3g ns\n", a.StringOrder)
+	fmt.Fprintf(&sb, "Symbol comparison:      %.3g ns\n", a.SymbolCompare)
+	fmt.Fprintf(&sb, "Eq allocation:          %.3g ns\n", a.EqAlloc)
+	fmt.Fprintf(&sb, "LGE allocation:         %.3g ns\n", a.LGEAlloc)
+	fmt.Fprintf(&sb, "Eq break-even ratio:    %.3g\n", a.EqBreakEven)
+	fmt.Fprintf(&sb, "LGE break-even ratio:   %.3g\n", a.LGEBreakEven)
+	use := map[bool]string{false: "strings", true: "symbols"}
+	fmt.Fprintf(&sb, "For equality tests use: %s\n", use[a.UseEq])
+	fmt.Fprintf(&sb, "For ordering tests use: %s\n", use[a.UseLGE])
+	return sb.String()
+}
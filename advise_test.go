@@ -0,0 +1,33 @@
+// This file provides unit tests for the workload advisor.
+
+package intern_test
+
+import (
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// TestAdvise ensures that Advise produces plausible advice without modifying
+// the package's symbol tables.
+func TestAdvise(t *testing.T) {
+	intern.ForgetAllEqs()
+	intern.ForgetAllLGEs()
+	strs := generateSimilarStrings(1000)
+	lo := intern.Advise(strs, 0)
+	hi := intern.Advise(strs, 1e12)
+	if intern.NumEqs() != 0 || intern.NumLGEs() != 0 {
+		t.Fatal("Advise modified the symbol tables")
+	}
+	for _, a := range []intern.Advice{lo, hi} {
+		if a.StringEqual <= 0 || a.StringOrder <= 0 || a.SymbolCompare <= 0 || a.EqAlloc <= 0 || a.LGEAlloc <= 0 {
+			t.Fatalf("Expected positive costs but saw\n%s", a)
+		}
+	}
+	if lo.UseEq || lo.UseLGE {
+		t.Fatalf("Expected strings to win with no comparisons but saw\n%s", lo)
+	}
+	if !hi.UseEq || !hi.UseLGE {
+		t.Fatalf("Expected symbols to win with many comparisons but saw\n%s", hi)
+	}
+}
@@ -0,0 +1,419 @@
+/*
+Intern builds, inspects, and queries symbol tables saved by the intern
+package's WriteEqs and WriteLGEs functions.
+
+Usage:
+
+	intern [-type eq|lge] build [-words] [-o table] [file...]
+	intern [-type eq|lge] stats table
+	intern [-type eq|lge] lookup [-sym] table key...
+	intern [-type eq|lge] dump table
+	intern [-type eq|lge] diff old-table new-table
+	intern advise [-words] [-ratio r] [file...]
+
+The -type option selects between Eq tables (the default) and LGE tables.
+
+The build command reads strings from the named files (or from standard input
+if no files are named), one string per line or, with -words, one string per
+whitespace-separated word.  It interns the strings and writes the resulting
+table to the file named by -o or to standard output.
+
+The stats command reports the number of symbols in a table, the total number
+of bytes in their strings, and, for LGE tables, the depth of the tree used to
+assign LGEs.
+
+The lookup command reports the symbol associated with each given string or,
+with -sym, the string associated with each given symbol.
+
+The dump command writes a table with the strings in sorted order.
+
+The diff command reports the strings added to ("+") and removed from ("-") a
+table.
+
+The advise command reads a sample of strings in the same manner as build and
+reports whether symbols or plain strings are likely to be faster for a
+workload that performs -ratio comparisons per string it interns.  The -type
+option does not apply to advise.
+*/
+package main
+
+import (
+	"bufio"
+	"encoding"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spakin/intern"
+)
+
+// A table abstracts over the Eq and LGE tables.
+type table struct {
+	read   func(io.Reader) error       // Replace the table's contents
+	write  func(io.Writer) error       // Write the table's contents
+	intern func([]string) error        // Intern a list of strings
+	lookup func(string) (uint64, bool) // Map a string to a symbol
+	str    func(uint64) (string, bool) // Map a symbol to a string
+	all    func() []mapping            // Return all symbols and strings
+	depth  func() (int, bool)          // Return the tree depth, if applicable
+}
+
+// A mapping associates a symbol with its string.
+type mapping struct {
+	sym uint64 // Symbol
+	str string // String
+}
+
+// eqTable is a table of Eqs.
+var eqTable = table{
+	read:  intern.ReadEqs,
+	write: intern.WriteEqs,
+	intern: func(ss []string) error {
+		_ = intern.NewEqMulti(ss)
+		return nil
+	},
+	lookup: func(s string) (uint64, bool) {
+		sym, ok := intern.LookupEq(s)
+		return uint64(sym), ok
+	},
+	str: func(sym uint64) (string, bool) {
+		return symString(intern.Eq(sym))
+	},
+	all: func() []mapping {
+		var ms []mapping
+		for sym, str := range intern.AllEqs() {
+			ms = append(ms, mapping{sym: uint64(sym), str: str})
+		}
+		return ms
+	},
+	depth: func() (int, bool) { return 0, false },
+}
+
+// lgeTable is a table of LGEs.
+var lgeTable = table{
+	read:  intern.ReadLGEs,
+	write: intern.WriteLGEs,
+	intern: func(ss []string) error {
+		_, err := intern.NewLGEMulti(ss)
+		if err != nil {
+			// NewLGEMulti discards strings that do not fit, so
+			// queue them again before rebuilding the table.
+			intern.PreLGEMulti(ss)
+			_, err = intern.RemapAllLGEs()
+		}
+		return err
+	},
+	lookup: func(s string) (uint64, bool) {
+		sym, ok := intern.LookupLGE(s)
+		return uint64(sym), ok
+	},
+	str: func(sym uint64) (string, bool) {
+		return symString(intern.LGE(sym))
+	},
+	all: func() []mapping {
+		var ms []mapping
+		for sym, str := range intern.AllLGEs() {
+			ms = append(ms, mapping{sym: uint64(sym), str: str})
+		}
+		return ms
+	},
+	depth: func() (int, bool) {
+		d := -1
+		for sym := range intern.AllLGEs() {
+			d = max(d, sym.Depth())
+		}
+		return d, true
+	},
+}
+
+// symString returns the string associated with a symbol.  The second return
+// value is false if the symbol is not associated with any string.
+func symString(sym encoding.TextMarshaler) (string, bool) {
+	b, err := sym.MarshalText()
+	if err != nil {
+		return "", false // MarshalText fails only with ErrInvalid.
+	}
+	return string(b), true
+}
+
+// diffMappings returns the strings present in ms but not in old and the
+// strings present in old but not in ms, each in sorted order.
+func diffMappings(ms, old []mapping) (add, rm []string) {
+	seen := make(map[string]bool, len(old))
+	for _, m := range old {
+		seen[m.str] = true
+	}
+	for _, m := range ms {
+		if !seen[m.str] {
+			add = append(add, m.str)
+		}
+		delete(seen, m.str)
+	}
+	for s := range seen {
+		rm = append(rm, s)
+	}
+	sort.Strings(add)
+	sort.Strings(rm)
+	return add, rm
+}
+
+// load replaces a table's contents with those of a named file.
+func (t *table) load(fname string) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = t.read(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", fname, err)
+	}
+	return nil
+}
+
+// readStrings reads strings from an io.Reader, one per line or, if words is
+// true, one per whitespace-separated word.
+func readStrings(r io.Reader, words bool) ([]string, error) {
+	var ss []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+	if words {
+		scanner.Split(bufio.ScanWords)
+	}
+	for scanner.Scan() {
+		ss = append(ss, scanner.Text())
+	}
+	return ss, scanner.Err()
+}
+
+// readInputs reads strings from each named file or, if no files are named,
+// from standard input.
+func readInputs(fnames []string, stdin io.Reader, words bool) ([]string, error) {
+	if len(fnames) == 0 {
+		return readStrings(stdin, words)
+	}
+	var ss []string
+	for _, fname := range fnames {
+		f, err := os.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		more, err := readStrings(f, words)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, more...)
+	}
+	return ss, nil
+}
+
+// build implements the build command.
+func build(t *table, args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("build", flag.ContinueOnError)
+	words := fs.Bool("words", false, "Intern whitespace-separated words instead of lines")
+	oName := fs.String("o", "", "Output file (default: standard output)")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	// Read and intern all of the input strings.
+	ss, err := readInputs(fs.Args(), stdin, *words)
+	if err != nil {
+		return err
+	}
+	err = t.intern(ss)
+	if err != nil {
+		return err
+	}
+
+	// Write the table.
+	if *oName == "" {
+		return t.write(stdout)
+	}
+	f, err := os.Create(*oName)
+	if err != nil {
+		return err
+	}
+	err = t.write(f)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// stats implements the stats command.
+func stats(t *table, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("stats requires exactly one table")
+	}
+	err := t.load(args[0])
+	if err != nil {
+		return err
+	}
+	ms := t.all()
+	nb := 0
+	for _, m := range ms {
+		nb += len(m.str)
+	}
+	fmt.Fprintf(stdout, "Symbols: %d\n", len(ms))
+	fmt.Fprintf(stdout, "Bytes:   %d\n", nb)
+	if d, ok := t.depth(); ok {
+		fmt.Fprintf(stdout, "Depth:   %d\n", d)
+	}
+	return nil
+}
+
+// lookup implements the lookup command.
+func lookup(t *table, args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("lookup", flag.ContinueOnError)
+	bySym := fs.Bool("sym", false, "Look up symbols instead of strings")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() < 1 {
+		return fmt.Errorf("lookup requires a table")
+	}
+	err = t.load(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for _, key := range fs.Args()[1:] {
+		if *bySym {
+			sym, err := strconv.ParseUint(key, 10, 64)
+			if err != nil {
+				return err
+			}
+			if str, ok := t.str(sym); ok {
+				fmt.Fprintf(stdout, "%d\t%q\n", sym, str)
+			} else {
+				fmt.Fprintf(stdout, "%d\tnot found\n", sym)
+			}
+			continue
+		}
+		if sym, ok := t.lookup(key); ok {
+			fmt.Fprintf(stdout, "%d\t%q\n", sym, key)
+		} else {
+			fmt.Fprintf(stdout, "not found\t%q\n", key)
+		}
+	}
+	return nil
+}
+
+// dump implements the dump command.
+func dump(t *table, args []string, stdout io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("dump requires exactly one table")
+	}
+	err := t.load(args[0])
+	if err != nil {
+		return err
+	}
+	ms := t.all()
+	sort.Slice(ms, func(i, j int) bool { return ms[i].str < ms[j].str })
+	bw := bufio.NewWriter(stdout)
+	for _, m := range ms {
+		fmt.Fprintf(bw, "%d\t%q\n", m.sym, m.str)
+	}
+	return bw.Flush()
+}
+
+// diff implements the diff command.
+func diff(t *table, args []string, stdout io.Writer) error {
+	if len(args) != 2 {
+		return fmt.Errorf("diff requires exactly two tables")
+	}
+	err := t.load(args[0])
+	if err != nil {
+		return err
+	}
+	old := t.all()
+	err = t.load(args[1])
+	if err != nil {
+		return err
+	}
+	add, rm := diffMappings(t.all(), old)
+	bw := bufio.NewWriter(stdout)
+	for _, s := range rm {
+		fmt.Fprintf(bw, "-\t%q\n", s)
+	}
+	for _, s := range add {
+		fmt.Fprintf(bw, "+\t%q\n", s)
+	}
+	return bw.Flush()
+}
+
+// advise implements the advise command.
+func advise(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("advise", flag.ContinueOnError)
+	words := fs.Bool("words", false, "Sample whitespace-separated words instead of lines")
+	ratio := fs.Float64("ratio", 1, "Expected comparisons per interned string")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	ss, err := readInputs(fs.Args(), stdin, *words)
+	if err != nil {
+		return err
+	}
+	if len(ss) == 0 {
+		return fmt.Errorf("advise requires a nonempty sample")
+	}
+	_, err = io.WriteString(stdout, intern.Advise(ss, *ratio).String())
+	return err
+}
+
+// run executes a command line and returns an error status.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("intern", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	ty := fs.String("type", "eq", `Table type ("eq" or "lge")`)
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+	var t *table
+	switch strings.ToLower(*ty) {
+	case "eq":
+		t = &eqTable
+	case "lge":
+		t = &lgeTable
+	default:
+		return fmt.Errorf("unknown table type %q", *ty)
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("a command (build, stats, lookup, dump, diff, or advise) is required")
+	}
+	cmd, cArgs := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "build":
+		return build(t, cArgs, stdin, stdout)
+	case "stats":
+		return stats(t, cArgs, stdout)
+	case "lookup":
+		return lookup(t, cArgs, stdout)
+	case "dump":
+		return dump(t, cArgs, stdout)
+	case "diff":
+		return diff(t, cArgs, stdout)
+	case "advise":
+		return advise(cArgs, stdin, stdout)
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "intern: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,98 @@
+// This file provides unit tests for the intern command.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runOK runs a command line and returns its output, failing on error.
+func runOK(t *testing.T, args ...string) string {
+	t.Helper()
+	var out, errOut strings.Builder
+	err := run(args, strings.NewReader(""), &out, &errOut)
+	if err != nil {
+		t.Fatalf("intern %s: %v", strings.Join(args, " "), err)
+	}
+	return out.String()
+}
+
+// TestCommands builds, inspects, and compares tables of each type.
+func TestCommands(t *testing.T) {
+	dir := t.TempDir()
+	in1 := filepath.Join(dir, "in1.txt")
+	in2 := filepath.Join(dir, "in2.txt")
+	err := os.WriteFile(in1, []byte("banana\napple\ncherry\napple\n"), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(in2, []byte("banana split\ndate\n"), 0o666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ty := range []string{"eq", "lge"} {
+		t1 := filepath.Join(dir, ty+"1.tab")
+		t2 := filepath.Join(dir, ty+"2.tab")
+		runOK(t, "-type", ty, "build", "-o", t1, in1)
+		runOK(t, "-type", ty, "build", "-words", "-o", t2, in1, in2)
+
+		// Check the statistics.
+		out := runOK(t, "-type", ty, "stats", t2)
+		if !strings.Contains(out, "Symbols: 5\n") || !strings.Contains(out, "Bytes:   26\n") {
+			t.Fatalf("Unexpected %s statistics:\n%s", ty, out)
+		}
+		if strings.Contains(out, "Depth:") != (ty == "lge") {
+			t.Fatalf("Unexpected %s statistics:\n%s", ty, out)
+		}
+
+		// Look up a string then look up its symbol.
+		out = runOK(t, "-type", ty, "lookup", t2, "date", "kiwi")
+		lines := strings.Split(out, "\n")
+		if len(lines) != 3 || !strings.HasSuffix(lines[0], "\t\"date\"") || lines[1] != "not found\t\"kiwi\"" {
+			t.Fatalf("Unexpected %s lookup results:\n%s", ty, out)
+		}
+		sym := strings.Split(lines[0], "\t")[0]
+		out = runOK(t, "-type", ty, "lookup", "-sym", t2, sym, "0")
+		if out != lines[0]+"\n0\tnot found\n" {
+			t.Fatalf("Expected %q but saw %q", lines[0]+"\n0\tnot found\n", out)
+		}
+
+		// Ensure that dumps are sorted.
+		out = runOK(t, "-type", ty, "dump", t2)
+		var strs []string
+		for _, ln := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+			strs = append(strs, strings.Split(ln, "\t")[1])
+		}
+		if strings.Join(strs, " ") != `"apple" "banana" "cherry" "date" "split"` {
+			t.Fatalf("Unexpected %s dump:\n%s", ty, out)
+		}
+
+		// Compare the two tables.
+		out = runOK(t, "-type", ty, "diff", t1, t2)
+		if out != "+\t\"date\"\n+\t\"split\"\n" {
+			t.Fatalf("Unexpected %s diff:\n%s", ty, out)
+		}
+	}
+
+	// Request advice for a small sample.
+	out := runOK(t, "advise", "-words", "-ratio", "1e12", in1, in2)
+	if !strings.Contains(out, "For equality tests use: symbols\n") {
+		t.Fatalf("Unexpected advice:\n%s", out)
+	}
+
+	// Ensure that bad commands are rejected.
+	var errOut strings.Builder
+	for _, args := range [][]string{
+		{"bogus"},
+		{"-type", "bogus", "stats", in1},
+		{"stats", in1},
+		{"advise"},
+	} {
+		if run(args, strings.NewReader(""), &errOut, &errOut) == nil {
+			t.Fatalf("Failed to reject %q", args)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Package debughttp serves web pages for inspecting the intern package's symbol
+tables in a running program.
+
+The package is typically imported only for the side effect of registering its
+HTTP handler under the /debug/intern/ path on http.DefaultServeMux, in the
+same manner as net/http/pprof:
+
+	import _ "github.com/spakin/intern/debughttp"
+
+If the program does not already run a web server, start one:
+
+	go func() {
+		log.Println(http.ListenAndServe("localhost:6060", nil))
+	}()
+
+then visit http://localhost:6060/debug/intern/ in a browser.  To serve the
+pages from a different mux or path, mount the value returned by Handler at
+any path that ends in a slash.
+
+The pages are:
+
+	/debug/intern/        statistics for the Eq and LGE tables
+	/debug/intern/eq      a searchable listing of Eqs and their strings
+	/debug/intern/lge     a searchable listing of LGEs, their strings, and their depths
+	/debug/intern/tree    the shape of the tree used to assign LGEs and its remaining headroom
+
+The listings accept a q parameter, which selects the strings containing q as
+a substring and the symbol whose decimal value is q, and an n parameter,
+which limits the number of results shown (default 100).
+*/
+package debughttp
+
+import (
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/spakin/intern"
+)
+
+// init registers the handler on http.DefaultServeMux.
+func init() {
+	http.Handle("/debug/intern/", Handler())
+}
+
+// maxDepth is the maximum depth of an LGE in the LGE tree.
+const maxDepth = 63
+
+// defaultLimit is the default number of results in a listing.
+const defaultLimit = 100
+
+// A tableStats associates a table's name with its statistics.
+type tableStats struct {
+	Name  string       // Table name
+	Stats intern.Stats // Table statistics
+}
+
+// A row is one entry in a listing.
+type row struct {
+	Sym   uint64 // Symbol
+	Str   string // String associated with Sym
+	Depth int    // Depth of an LGE in the LGE tree
+}
+
+// A listing is the data presented on a listing page.
+type listing struct {
+	Type    string // "Eq" or "LGE"
+	Query   string // Search string
+	Limit   int    // Maximum number of rows
+	Matches int    // Number of matching symbols, including those not shown
+	Rows    []row  // Symbols to show
+}
+
+// A level summarizes one level of the LGE tree.
+type level struct {
+	Depth    int    // Depth in the tree
+	Nodes    int    // Number of LGEs at this depth
+	Capacity uint64 // Maximum number of LGEs at this depth
+}
+
+// A treeShape is the data presented on the tree page.
+type treeShape struct {
+	Symbols  int     // Number of LGEs
+	Depth    int     // Depth of the deepest LGE or -1 if there are none
+	Headroom int     // Number of levels below the deepest LGE
+	Levels   []level // Per-level summary
+	Deepest  []row   // LGEs at the maximum depth
+}
+
+// page is the template shared by all pages.
+var page = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head><title>intern: {{.Title}}</title></head>
+<body>
+<p><a href="./">Statistics</a> | <a href="eq">Eqs</a> | <a href="lge">LGEs</a> | <a href="tree">LGE tree</a></p>
+<h1>{{.Title}}</h1>
+{{with .Stats}}
+<table border="1">
+<tr><th>Table</th><th>Symbols</th><th>Bytes</th><th>Pending</th><th>Frozen</th><th>Hits</th><th>Misses</th><th>Failures</th><th>Remaps</th><th>Lock wait</th></tr>
+{{range .}}<tr><td>{{.Name}}</td>{{with .Stats}}<td>{{.Symbols}}</td><td>{{.Bytes}}</td><td>{{.Pending}}</td><td>{{.Frozen}}</td><td>{{.Hits}}</td><td>{{.Misses}}</td><td>{{.Failures}}</td><td>{{.Remaps}}</td><td>{{.LockWait}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+{{with .List}}
+<form method="get">
+<input type="text" name="q" value="{{.Query}}"> <input type="number" name="n" value="{{.Limit}}"> <input type="submit" value="Search">
+</form>
+<p>Showing {{len .Rows}} of {{.Matches}} matching {{.Type}}s.</p>
+<table border="1">
+<tr><th>{{.Type}}</th><th>String</th>{{if eq .Type "LGE"}}<th>Depth</th>{{end}}</tr>
+{{range .Rows}}<tr><td>{{.Sym}}</td><td>{{printf "%q" .Str}}</td>{{if eq $.List.Type "LGE"}}<td>{{.Depth}}</td>{{end}}</tr>
+{{end}}</table>
+{{end}}
+{{with .Tree}}
+<p>{{.Symbols}} LGEs; maximum depth {{.Depth}}; {{.Headroom}} levels of headroom below the deepest LGE.
+NewLGE fails when a string would need to be placed below depth 63.</p>
+<table border="1">
+<tr><th>Depth</th><th>LGEs</th><th>Capacity</th></tr>
+{{range .Levels}}<tr><td>{{.Depth}}</td><td>{{.Nodes}}</td><td>{{.Capacity}}</td></tr>
+{{end}}</table>
+<h2>Deepest LGEs</h2>
+<table border="1">
+<tr><th>LGE</th><th>String</th></tr>
+{{range .Deepest}}<tr><td>{{.Sym}}</td><td>{{printf "%q" .Str}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
+
+// pageData is the data passed to the page template.  Exactly one of Stats,
+// List, and Tree is non-nil.
+type pageData struct {
+	Title string       // Page title
+	Stats []tableStats // Statistics for each table
+	List  *listing     // Listing of symbols
+	Tree  *treeShape   // Shape of the LGE tree
+}
+
+// search returns a listing of all symbols that match a query.
+func search(ty string, all func(yield func(row) bool), q string, limit int) *listing {
+	ls := &listing{Type: ty, Query: q, Limit: limit}
+	qSym, err := strconv.ParseUint(q, 10, 64)
+	isSym := err == nil
+	all(func(r row) bool {
+		if strings.Contains(r.Str, q) || (isSym && r.Sym == qSym) {
+			ls.Matches++
+			if len(ls.Rows) < limit {
+				ls.Rows = append(ls.Rows, r)
+			}
+		}
+		return true
+	})
+	return ls
+}
+
+// allEqs yields a row for each Eq.
+func allEqs(yield func(row) bool) {
+	for sym, str := range intern.AllEqs() {
+		if !yield(row{Sym: uint64(sym), Str: str}) {
+			return
+		}
+	}
+}
+
+// allLGEs yields a row for each LGE.
+func allLGEs(yield func(row) bool) {
+	for sym, str := range intern.AllLGEs() {
+		if !yield(row{Sym: uint64(sym), Str: str, Depth: sym.Depth()}) {
+			return
+		}
+	}
+}
+
+// shape summarizes the shape of the LGE tree.
+func shape(limit int) *treeShape {
+	ts := &treeShape{Depth: -1}
+	var counts [maxDepth + 1]int
+	var rows []row
+	allLGEs(func(r row) bool {
+		ts.Symbols++
+		counts[r.Depth]++
+		rows = append(rows, r)
+		ts.Depth = max(ts.Depth, r.Depth)
+		return true
+	})
+	ts.Headroom = maxDepth - ts.Depth
+	for d := 0; d <= ts.Depth; d++ {
+		ts.Levels = append(ts.Levels, level{Depth: d, Nodes: counts[d], Capacity: 1 << d})
+	}
+	for _, r := range rows {
+		if r.Depth == ts.Depth && len(ts.Deepest) < limit {
+			ts.Deepest = append(ts.Deepest, r)
+		}
+	}
+	return ts
+}
+
+// Handler returns an http.Handler that serves the pages described in the
+// package documentation.  The handler selects a page based on the final
+// element of the request path.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultLimit
+		if n, err := strconv.Atoi(r.FormValue("n")); err == nil && n >= 0 {
+			limit = n
+		}
+		q := r.FormValue("q")
+		var data pageData
+		switch name := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]; name {
+		case "":
+			data.Title = "Symbol-table statistics"
+			data.Stats = []tableStats{
+				{"Eq", intern.EqStats()},
+				{"LGE", intern.LGEStats()},
+			}
+		case "eq":
+			data.Title = "Eqs"
+			data.List = search("Eq", allEqs, q, limit)
+		case "lge":
+			data.Title = "LGEs"
+			data.List = search("LGE", allLGEs, q, limit)
+		case "tree":
+			data.Title = "LGE tree"
+			data.Tree = shape(limit)
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = page.Execute(w, data) // Fails only if the client went away.
+	})
+}
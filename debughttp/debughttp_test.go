@@ -0,0 +1,70 @@
+// This file provides unit tests for the debughttp package.
+
+package debughttp_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spakin/intern"
+	_ "github.com/spakin/intern/debughttp"
+)
+
+// get fetches a page from http.DefaultServeMux and returns its status code and
+// body.
+func get(t *testing.T, url string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, string(body)
+}
+
+// TestPages ensures that each page is served and contains the expected data.
+func TestPages(t *testing.T) {
+	intern.ForgetAllEqs()
+	intern.ForgetAllLGEs()
+	words := []string{"apple", "banana", "cherry", "<script>"}
+	intern.NewEqMulti(words)
+	intern.PreLGEMulti(words)
+	_, err := intern.NewLGEMulti(words)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		url  string
+		want []string
+		omit []string
+	}{
+		{"/debug/intern/", []string{"<td>Eq</td><td>4</td>", "<td>LGE</td><td>4</td>"}, nil},
+		{"/debug/intern/eq?q=an", []string{"1 of 1 matching Eqs", "&#34;banana&#34;"}, []string{"apple"}},
+		{"/debug/intern/eq?q=1", []string{"1 of 1 matching Eqs", "&#34;apple&#34;"}, nil},
+		{"/debug/intern/eq?n=2", []string{"2 of 4 matching Eqs"}, nil},
+		{"/debug/intern/lge", []string{"4 of 4 matching LGEs", "&lt;script&gt;", "<th>Depth</th>"}, []string{"<script>"}},
+		{"/debug/intern/tree", []string{"4 LGEs; maximum depth 2; 61 levels", "<td>0</td><td>1</td><td>1</td>"}, nil},
+	} {
+		code, body := get(t, tc.url)
+		if code != http.StatusOK {
+			t.Fatalf("%s: Expected status %d but saw %d", tc.url, http.StatusOK, code)
+		}
+		for _, s := range tc.want {
+			if !strings.Contains(body, s) {
+				t.Fatalf("%s: Expected %q in\n%s", tc.url, s, body)
+			}
+		}
+		for _, s := range tc.omit {
+			if strings.Contains(body, s) {
+				t.Fatalf("%s: Did not expect %q in\n%s", tc.url, s, body)
+			}
+		}
+	}
+	if code, _ := get(t, "/debug/intern/bogus"); code != http.StatusNotFound {
+		t.Fatalf("Expected status %d but saw %d", http.StatusNotFound, code)
+	}
+}
@@ -0,0 +1,152 @@
+// This file exports the tree used to assign LGEs in Graphviz DOT format.
+
+package intern
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// dotQuote quotes a label for use in a DOT file.  Lines in the label are
+// separated by "\n".
+func dotQuote(lines ...string) string {
+	for i, ln := range lines {
+		ln = strings.ReplaceAll(ln, `\`, `\\`)
+		lines[i] = strings.ReplaceAll(ln, `"`, `\"`)
+	}
+	return `"` + strings.Join(lines, `\n`) + `"`
+}
+
+// writeDOTNode writes a tree node to a DOT file.
+func writeDOTNode(w io.Writer, t *tree) {
+	d := depthOf(t.sym)
+	fmt.Fprintf(w, "\tn%d [label=%s];\n", t.sym, dotQuote(
+		strconv.Quote(t.str),
+		fmt.Sprintf("LGE %d", t.sym),
+		fmt.Sprintf("depth %d", d),
+		fmt.Sprintf("increment %d", incrAt(d)),
+		fmt.Sprintf("subtree %d of %d", t.size, capacityAt(d))))
+}
+
+// writeDOTEdge writes the edge from a tree node to one of its children to a
+// DOT file.
+func writeDOTEdge(w io.Writer, parent, child *tree) {
+	dir := "<"
+	if child.str > parent.str {
+		dir = ">"
+	}
+	fmt.Fprintf(w, "\tn%d -> n%d [label=%s];\n", parent.sym, child.sym, dotQuote(dir))
+}
+
+// writeDOTSubtree writes all nodes and edges in a tree to a DOT file.
+func writeDOTSubtree(w io.Writer, t *tree) {
+	if t == nil {
+		return
+	}
+	writeDOTNode(w, t)
+	for _, c := range []*tree{t.left, t.right} {
+		if c != nil {
+			writeDOTEdge(w, t, c)
+			writeDOTSubtree(w, c)
+		}
+	}
+}
+
+// writeDOTPath writes to a DOT file the nodes on the path from the root of a
+// tree to a given string, the children of each of those nodes, and, if the
+// string is not in the tree, a placeholder node indicating where the string
+// would be inserted.
+func writeDOTPath(w io.Writer, t *tree, s string) {
+	var parent *tree
+	for t != nil {
+		writeDOTNode(w, t)
+		if parent != nil {
+			writeDOTEdge(w, parent, t)
+		}
+		if s == t.str {
+			for _, c := range []*tree{t.left, t.right} {
+				if c != nil {
+					writeDOTNode(w, c)
+					writeDOTEdge(w, t, c)
+				}
+			}
+			return
+		}
+		next, other := t.right, t.left
+		if s < t.str {
+			next, other = t.left, t.right
+		}
+		if other != nil {
+			writeDOTNode(w, other)
+			writeDOTEdge(w, t, other)
+		}
+		parent, t = t, next
+	}
+
+	// The string is not in the tree.  Show where it would go.
+	label := []string{strconv.Quote(s), "not interned"}
+	color := "black"
+	if parent == nil {
+		label = append(label, fmt.Sprintf("would be LGE %d at depth 0", symbol(1<<63)))
+	} else {
+		d := depthOf(parent.sym)
+		incr := incrAt(d)
+		switch {
+		case incr == 0:
+			label = append(label, "no room: table full")
+			color = "red"
+		case s < parent.str:
+			label = append(label, fmt.Sprintf("would be LGE %d at depth %d", parent.sym-incr, d+1))
+		default:
+			label = append(label, fmt.Sprintf("would be LGE %d at depth %d", parent.sym+incr, d+1))
+		}
+	}
+	fmt.Fprintf(w, "\tmissing [label=%s, style=\"dashed\", color=%s];\n", dotQuote(label...), dotQuote(color))
+	if parent != nil {
+		dir := ">"
+		if s < parent.str {
+			dir = "<"
+		}
+		fmt.Fprintf(w, "\tn%d -> missing [label=%s, style=\"dashed\"];\n", parent.sym, dotQuote(dir))
+	}
+}
+
+// writeLGETree writes a DOT graph to an io.Writer, using a given function to
+// write the graph's nodes and edges.
+func writeLGETree(w io.Writer, body func(io.Writer, *tree)) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph LGE {")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	lge.RLock()
+	body(bw, lge.tree)
+	lge.RUnlock()
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// WriteLGETree writes the tree the package uses to assign LGEs to an
+// io.Writer as a Graphviz DOT graph.  Each node shows a string, its LGE, its
+// depth, the increment that separates it from its children (which falls to
+// zero at depth 63), and the number of strings in its subtree out of the
+// number that could fit.  Strings passed to PreLGE but not yet interned are
+// not shown.  WriteLGETree helps diagnose NewLGE failures: render its output
+// with a command such as "dot -Tsvg".
+func WriteLGETree(w io.Writer) error {
+	return writeLGETree(w, writeDOTSubtree)
+}
+
+// WriteLGETreePath is like WriteLGETree but writes only the path from the
+// root of the tree to a given string plus the immediate children of each node
+// along that path.  If the string has not been interned, WriteLGETreePath
+// additionally writes a dashed node indicating where the string would be
+// inserted or that there is no room for it.  The output is much smaller than
+// that of WriteLGETree and shows how the insertion order of the string's
+// neighbors exhausted the space available to it.
+func WriteLGETreePath(w io.Writer, s string) error {
+	return writeLGETree(w, func(w io.Writer, t *tree) {
+		writeDOTPath(w, t, s)
+	})
+}
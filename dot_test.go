@@ -0,0 +1,95 @@
+// This file provides unit tests for exporting the LGE tree.
+
+package intern_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// TestWriteLGETree ensures that WriteLGETree writes every node and edge of the
+// LGE tree and escapes strings properly.
+func TestWriteLGETree(t *testing.T) {
+	intern.ForgetAllLGEs()
+	strs := []string{"apple", `say "hi"`, `back\slash`, "cherry", "date"}
+	intern.PreLGEMulti(strs)
+	_, err := intern.NewLGEMulti(strs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = intern.WriteLGETree(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.HasPrefix(out, "digraph LGE {\n") || !strings.HasSuffix(out, "}\n") {
+		t.Fatalf("Malformed DOT graph:\n%s", out)
+	}
+	if n := strings.Count(out, " [label="); n != 2*len(strs)-1 {
+		t.Fatalf("Expected %d nodes and edges but saw %d in\n%s", 2*len(strs)-1, n, out)
+	}
+	for _, s := range []string{`\"say \\\"hi\\\"\"`, `\"back\\\\slash\"`, `depth 0\nincrement 4611686018427387904`} {
+		if !strings.Contains(out, s) {
+			t.Fatalf("Expected %s in\n%s", s, out)
+		}
+	}
+}
+
+// TestWriteLGETreePath ensures that WriteLGETreePath shows why a string could
+// not be interned.
+func TestWriteLGETreePath(t *testing.T) {
+	// Add strings in an order that exhausts the space after "b".
+	intern.ForgetAllLGEs()
+	_, err := intern.NewLGE("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s string
+	for s = "b"; err == nil; {
+		s += "z"
+		_, err = intern.NewLGE(s)
+	}
+
+	// Ensure that the path to the rejected string ends in a full table.
+	var buf bytes.Buffer
+	err = intern.WriteLGETreePath(&buf, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n := strings.Count(out, "depth 63\\n"); n != 1 {
+		t.Fatalf("Expected one node at depth 63 but saw %d in\n%s", n, out)
+	}
+	if !strings.Contains(out, "no room: table full") || !strings.Contains(out, "-> missing") {
+		t.Fatalf("Expected a full table in\n%s", out)
+	}
+
+	// Ensure that the path to an interned string includes only that path.
+	buf.Reset()
+	err = intern.WriteLGETreePath(&buf, "bzz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = buf.String()
+	if n := strings.Count(out, " -> "); n != 3 {
+		t.Fatalf("Expected 3 edges but saw %d in\n%s", n, out)
+	}
+	if strings.Contains(out, "missing") {
+		t.Fatalf("Did not expect a missing node in\n%s", out)
+	}
+
+	// Ensure that an empty tree shows where the string would go.
+	intern.ForgetAllLGEs()
+	buf.Reset()
+	err = intern.WriteLGETreePath(&buf, "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out = buf.String(); !strings.Contains(out, "would be LGE 9223372036854775808 at depth 0") {
+		t.Fatalf("Unexpected DOT graph for an empty tree:\n%s", out)
+	}
+}
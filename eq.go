@@ -3,6 +3,14 @@
 
 package intern
 
+import (
+	"bufio"
+	"io"
+	"iter"
+	"sort"
+	"strconv"
+)
+
 // An Eq is a string that has been interned to an integer.  Eq supports only
 // equality and inequality comparisons, not greater than/less than comparisons.
 // (No checks are performed to enforce that usage model, unfortunately.)
@@ -18,25 +26,34 @@ func init() {
 
 // assignEq assigns the next available Eq symbol to a string and returns the
 // new symbol.  If the string already has an Eq associated with it, return the
-// old Eq without allocating a new one.
-func assignEq(s string) Eq {
-	// Check if the string was already assigned a symbol.
-	sym, ok := eq.strToSym[s]
-	if ok {
-		return Eq(sym)
-	}
-
-	// We haven't seen this string before.  Find a symbol for it.
-	sym = symbol(len(eq.symToStr) + 1)
-	eq.symToStr[sym] = s
-	eq.strToSym[s] = sym
-	return Eq(sym)
+// old Eq without allocating a new one.  assignEq returns an error if the
+// string cannot be assigned a symbol.
+func assignEq(s string) (Eq, error) {
+	sym, err := eq.assignNext(s, "Eq")
+	return Eq(sym), err
 }
 
 // NewEq maps a string to an Eq symbol.  It guarantees that two equal strings
-// will always map to the same Eq.
+// will always map to the same Eq.  NewEq panics if the string cannot be
+// interned, which can happen only if the Eq table has been frozen with
+// FreezeEqs or if interning the string would exceed the limits set with
+// SetEqLimits.  Use TryNewEq to receive an error instead.
 func NewEq(s string) Eq {
-	eq.Lock()
+	sym, err := TryNewEq(s)
+	if err != nil {
+		panic(err)
+	}
+	return sym
+}
+
+// TryNewEq is like NewEq but returns an error instead of panicking if the
+// string cannot be interned.
+func TryNewEq(s string) (Eq, error) {
+	if eq.frozen.Load() != nil {
+		sym, err := eq.frozenSymbol(s, "Eq")
+		return Eq(sym), err
+	}
+	eq.lock()
 	defer eq.Unlock()
 	return assignEq(s)
 }
@@ -45,55 +62,320 @@ func NewEq(s string) Eq {
 // strings instead of an individual string.  This amortizes some costs when
 // allocating a large number of Eqs at once.
 func NewEqMulti(ss []string) []Eq {
-	eq.Lock()
+	eq.lock()
 	defer eq.Unlock()
 	syms := make([]Eq, len(ss))
 	for i, s := range ss {
-		syms[i] = assignEq(s)
+		var err error
+		syms[i], err = assignEq(s)
+		if err != nil {
+			panic(err)
+		}
 	}
 	return syms
 }
 
+// NewEqBytes is like NewEq but accepts a slice of bytes.  It allocates memory
+// only when it creates a new Eq, in which case it copies the bytes to a new
+// string.
+func NewEqBytes(b []byte) Eq {
+	sym, err := TryNewEqBytes(b)
+	if err != nil {
+		panic(err)
+	}
+	return sym
+}
+
+// TryNewEqBytes is like TryNewEq but accepts a slice of bytes.  Like
+// NewEqBytes, it allocates memory only when it creates a new Eq.
+func TryNewEqBytes(b []byte) (Eq, error) {
+	if sym, ok := eq.lookupBytes(b); ok {
+		eq.counts.hits.Add(1)
+		return Eq(sym), nil
+	}
+	return TryNewEq(string(b))
+}
+
+// LookupEq returns the Eq associated with a string without allocating a new
+// Eq.  The second return value is false if the string has not been interned.
+func LookupEq(s string) (Eq, bool) {
+	sym, ok := eq.lookup(s)
+	return Eq(sym), ok
+}
+
+// LookupEqBytes is like LookupEq but accepts a slice of bytes.  It does not
+// allocate memory.
+func LookupEqBytes(b []byte) (Eq, bool) {
+	sym, ok := eq.lookupBytes(b)
+	return Eq(sym), ok
+}
+
+// Canonical returns the single, shared copy of a string held by the Eq
+// table, interning the string as an Eq if it was not already interned.  Large
+// datasets can replace each of their strings with its canonical copy so that
+// equal strings share storage.  Unlike Eqs, canonical strings remain valid
+// after ForgetEq and ForgetAllEqs, which release the table's references to
+// them so they can be reclaimed once the program drops its own references.
+// Use ForgetEq to release individual canonical strings that are no longer
+// needed.  If the Eq table is frozen or its limits have been reached and the
+// string was not previously interned, Canonical returns the string itself.
+func Canonical(s string) string {
+	if ft := eq.frozen.Load(); ft != nil {
+		if sym, ok := ft.lookup(s); ok {
+			eq.counts.hits.Add(1)
+			str, _ := ft.toString(sym)
+			return str
+		}
+		eq.counts.failures.Add(1)
+		return s
+	}
+	eq.lock()
+	defer eq.Unlock()
+	sym, err := assignEq(s)
+	if err != nil {
+		return s
+	}
+	if ft := eq.frozen.Load(); ft != nil {
+		str, _ := ft.toString(symbol(sym)) // Frozen while we waited
+		return str
+	}
+	return eq.symToStr[symbol(sym)]
+}
+
+// CanonicalBytes is like Canonical but accepts a slice of bytes.  It
+// allocates memory only when the string was not already interned.
+func CanonicalBytes(b []byte) string {
+	if ft := eq.frozen.Load(); ft != nil {
+		if sym, ok := ft.lookupBytes(b); ok {
+			eq.counts.hits.Add(1)
+			str, _ := ft.toString(sym)
+			return str
+		}
+		eq.counts.failures.Add(1)
+		return string(b)
+	}
+	eq.RLock()
+	sym, ok := eq.strToSym[string(b)]
+	str := eq.symToStr[sym]
+	eq.RUnlock()
+	if ok {
+		eq.counts.hits.Add(1)
+		return str
+	}
+	return Canonical(string(b))
+}
+
 // String converts an Eq back to a string.  It panics if given an Eq that was
 // not created using NewEq.
 func (s Eq) String() string {
 	return eq.toString(symbol(s), "Eq")
 }
 
+// SetEqLimits bounds the growth of the Eq table.  Once the limits are reached,
+// TryNewEq returns a PkgError with code ErrLimit when given a new string, and
+// NewEq and NewEqMulti panic.  Strings that were already interned remain
+// available.  The limits persist across calls to ForgetAllEqs.
+func SetEqLimits(lim Limits) {
+	eq.lock()
+	eq.limits = lim
+	eq.Unlock()
+}
+
+// ForgetEq discards the mapping from a single string to its Eq so the
+// associated memory can be reclaimed.  This is how programs release strings
+// returned by Canonical.  Copies of the string that Canonical already
+// returned remain valid.  The forgotten Eq is never assigned to another
+// string; if the string is interned again, it receives a new Eq.  Use this
+// function only when you know for sure that the string's previous Eq will not
+// subsequently be used, including as a key in an EqMap or StringMap.  ForgetEq
+// does nothing if the string was not interned, and it returns a PkgError with
+// code ErrFrozen if the Eq table is frozen.
+func ForgetEq(s string) error {
+	eq.lock()
+	defer eq.Unlock()
+	if eq.frozen.Load() != nil {
+		return frozenError("Eq")
+	}
+	sym, ok := eq.strToSym[s]
+	if !ok {
+		return nil
+	}
+	delete(eq.strToSym, s)
+	delete(eq.symToStr, sym)
+	eq.nbytes -= len(s)
+	eq.gen.Add(1)
+	return nil
+}
+
 // ForgetAllEqs discards all existing mappings from strings to Eqs so the
 // associated memory can be reclaimed.  Use this function only when you know
 // for sure that no previously mapped Eqs will subsequently be used.
 func ForgetAllEqs() {
-	eq.Lock()
+	eq.lock()
 	eq.forgetAll()
 	eq.Unlock()
 }
 
+// An EqMapping associates an Eq with its string.
+type EqMapping struct {
+	Sym Eq     // Interned string
+	Str string // Original string
+}
+
+// ExportEqs returns all interned Eqs and their associated strings in the
+// order in which the Eqs were allocated.  The result is a consistent snapshot
+// of the Eq table that is unaffected by subsequent calls to NewEq.
+func ExportEqs() []EqMapping {
+	eq.RLock()
+	defer eq.RUnlock()
+	if ft := eq.frozen.Load(); ft != nil {
+		ms := make([]EqMapping, len(ft.syms))
+		for i, sym := range ft.syms {
+			ms[i] = EqMapping{Sym: Eq(sym), Str: ft.strs[i]}
+		}
+		return ms
+	}
+	n := len(eq.symToStr)
+	ms := make([]EqMapping, 0, n)
+	if eq.last == symbol(n) {
+		// No Eqs were forgotten, so the Eqs are exactly 1 through n.
+		for sym := symbol(1); sym <= eq.last; sym++ {
+			ms = append(ms, EqMapping{Sym: Eq(sym), Str: eq.symToStr[sym]})
+		}
+		return ms
+	}
+	for sym, str := range eq.symToStr {
+		ms = append(ms, EqMapping{Sym: Eq(sym), Str: str})
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Sym < ms[j].Sym })
+	return ms
+}
+
+// NumEqs returns the number of strings that have been interned as Eqs.
+func NumEqs() int {
+	eq.RLock()
+	defer eq.RUnlock()
+	return eq.size()
+}
+
+// AllEqs returns an iterator over all interned Eqs and their associated
+// strings in the order in which the Eqs were allocated.  The iterator works
+// on a snapshot of the Eq table taken when iteration begins, so concurrent
+// calls to NewEq neither block nor affect the iteration, and the loop body
+// may safely call other functions in this package.
+func AllEqs() iter.Seq2[Eq, string] {
+	return func(yield func(Eq, string) bool) {
+		for _, m := range ExportEqs() {
+			if !yield(m.Sym, m.Str) {
+				return
+			}
+		}
+	}
+}
+
+// WriteEqs writes all interned Eqs and their associated strings to an
+// io.Writer in the order in which the Eqs were allocated.  Each line contains
+// an Eq as a decimal integer, a tab character, and the associated string as a
+// double-quoted Go string literal.
+func WriteEqs(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, 64)
+	for _, m := range ExportEqs() {
+		buf = strconv.AppendUint(buf[:0], uint64(m.Sym), 10)
+		buf = append(buf, '\t')
+		buf = strconv.AppendQuote(buf, m.Str)
+		buf = append(buf, '\n')
+		_, err := bw.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadEqs replaces all existing Eqs with those read from an io.Reader in the
+// format written by WriteEqs.  Blank lines and lines beginning with "#" are
+// ignored.  The Eqs must appear in allocation order, that is, in increasing
+// order.  Gaps are permitted because WriteEqs omits Eqs discarded by ForgetEq.
+// ReadEqs returns a PkgError with code ErrSyntax that indicates the offending
+// line if the input is malformed or a PkgError with code ErrLimit if the
+// table would exceed the limits set with SetEqLimits.  In either case, the Eq
+// table is left unmodified.  Like ForgetAllEqs, ReadEqs invalidates all
+// existing Eqs and unfreezes the Eq table.
+func ReadEqs(r io.Reader) error {
+	ents, err := readTable(r, "Eq", 0)
+	if err != nil {
+		return err
+	}
+	for i, ent := range ents {
+		if i > 0 && ent.sym < ents[i-1].sym {
+			return syntaxError(ent.line, ent.str, "Eq %d appears after Eq %d", ent.sym, ents[i-1].sym)
+		}
+	}
+	eq.lock()
+	defer eq.Unlock()
+	err = eq.admitTable(ents, "Eq")
+	if err != nil {
+		return err
+	}
+	eq.forgetAll()
+	for _, ent := range ents {
+		eq.symToStr[ent.sym] = ent.str
+		eq.strToSym[ent.str] = ent.sym
+		eq.nbytes += len(ent.str)
+		eq.last = ent.sym
+	}
+	return nil
+}
+
 // MarshalText converts an Eq to a string and that string to a slice of bytes.
 // With this method, Eq implements the encoding.TextMarshaler interface.
-func (s *Eq) MarshalText() ([]byte, error) {
-	return []byte(eq.toString(symbol(*s), "Eq")), nil
+// MarshalText returns a PkgError with code ErrInvalid if given the zero Eq
+// or any other Eq not associated with a string.
+func (s Eq) MarshalText() ([]byte, error) {
+	return eq.marshal(symbol(s), "Eq")
+}
+
+// tryNewEqSymbol is TryNewEq with a symbol return type.
+func tryNewEqSymbol(s string) (symbol, error) {
+	sym, err := TryNewEq(s)
+	return symbol(sym), err
 }
 
 // UnmarshalText converts an slice of bytes to a string then interns that
 // string to an Eq.  With this method, Eq implements the
-// encoding.TextUnmarshaler interface.
+// encoding.TextUnmarshaler interface.  See SetEqUnmarshalStrict for a way to
+// reject strings that have not already been interned.
 func (s *Eq) UnmarshalText(text []byte) error {
-	*s = NewEq(string(text))
-	return nil
+	sym, err := eq.unmarshal(text, "Eq", tryNewEqSymbol)
+	*s = Eq(sym)
+	return err
 }
 
 // MarshalBinary converts an Eq to a string and that string to a slice of
 // bytes.  With this method, Eq implements the encoding.BinaryMarshaler
-// interface.
-func (s *Eq) MarshalBinary() ([]byte, error) {
-	return []byte(eq.toString(symbol(*s), "Eq")), nil
+// interface.  Like MarshalText, MarshalBinary returns a PkgError with code
+// ErrInvalid if given an invalid Eq.
+func (s Eq) MarshalBinary() ([]byte, error) {
+	return eq.marshal(symbol(s), "Eq")
 }
 
 // UnmarshalBinary converts an slice of bytes to a string then interns that
 // string to an Eq.  With this method, Eq implements the
-// encoding.BinaryUnmarshaler interface.
+// encoding.BinaryUnmarshaler interface.  See SetEqUnmarshalStrict for a way
+// to reject strings that have not already been interned.
 func (s *Eq) UnmarshalBinary(data []byte) error {
-	*s = NewEq(string(data))
-	return nil
+	sym, err := eq.unmarshal(data, "Eq", tryNewEqSymbol)
+	*s = Eq(sym)
+	return err
+}
+
+// SetEqUnmarshalStrict enables or disables strict unmarshalling of Eqs.  In
+// strict mode, UnmarshalText and UnmarshalBinary never intern new strings.
+// Instead, they return a PkgError with code ErrUnknown when given a string
+// that was not previously interned.  This lets programs that decode data from
+// untrusted sources validate the data against a fixed vocabulary without
+// growing the Eq table.
+func SetEqUnmarshalStrict(strict bool) {
+	eq.strict.Store(strict)
 }
@@ -108,3 +108,117 @@ func BenchmarkMergeEqMaps(b *testing.B) {
 		m3[k] = Empty{}
 	}
 }
+
+// BenchmarkLookupEqs measures the time needed to look up existing Eqs.
+func BenchmarkLookupEqs(b *testing.B) {
+	intern.ForgetAllEqs()
+	strs := generateRandomStrings(b.N)
+	_ = intern.NewEqMulti(strs)
+	b.ResetTimer()
+	for _, s := range strs {
+		_, _ = intern.LookupEq(s)
+	}
+}
+
+// BenchmarkLookupFrozenEqs measures the time needed to look up existing Eqs
+// in a frozen table.
+func BenchmarkLookupFrozenEqs(b *testing.B) {
+	intern.ForgetAllEqs()
+	defer intern.ForgetAllEqs()
+	strs := generateRandomStrings(b.N)
+	_ = intern.NewEqMulti(strs)
+	intern.FreezeEqs()
+	b.ResetTimer()
+	for _, s := range strs {
+		_, _ = intern.LookupEq(s)
+	}
+}
+
+// BenchmarkMergeEqSets measures the performance of merging two EqSets.  It is
+// analogous to BenchmarkMergeEqMaps.
+func BenchmarkMergeEqSets(b *testing.B) {
+	// Populate two sets.
+	intern.ForgetAllEqs()
+	prng := rand.New(rand.NewSource(2223)) // Constant for reproducibility
+	const sLen = 20                        // Symbol length in characters
+	var s1, s2 intern.EqSet
+	for i := 0; i < b.N; i++ {
+		s := randomString(prng, sLen)
+		s1.Add(intern.NewEq(s))
+		s = randomString(prng, sLen)
+		s2.Add(intern.NewEq(s))
+	}
+
+	// Start the clock then merge the two sets into a third.
+	b.ResetTimer()
+	s3 := s1.Union(&s2)
+	Dummy += uint64(s3.Len())
+}
+
+// BenchmarkMergeDenseEqMaps measures the performance of retrieving a number
+// of Eqs from an EqMap.  It is analogous to BenchmarkMergeEqMaps.
+func BenchmarkMergeDenseEqMaps(b *testing.B) {
+	// Populate two maps.
+	intern.ForgetAllEqs()
+	prng := rand.New(rand.NewSource(2223)) // Constant for reproducibility
+	const sLen = 20                        // Symbol length in characters
+	type Empty struct{}
+	var m1, m2 intern.EqMap[Empty]
+	for i := 0; i < b.N; i++ {
+		s := randomString(prng, sLen)
+		m1.Set(intern.NewEq(s), Empty{})
+		s = randomString(prng, sLen)
+		m2.Set(intern.NewEq(s), Empty{})
+	}
+
+	// Start the clock then merge the two maps into a third.
+	var m3 intern.EqMap[Empty]
+	b.ResetTimer()
+	for k, v := range m1.All() {
+		m3.Set(k, v)
+	}
+	for k, v := range m2.All() {
+		m3.Set(k, v)
+	}
+}
+
+// BenchmarkMergeInternedStringMaps measures the performance of merging two
+// StringMaps.  It is analogous to BenchmarkMergeStringMaps.
+func BenchmarkMergeInternedStringMaps(b *testing.B) {
+	// Populate two maps.
+	intern.ForgetAllEqs()
+	prng := rand.New(rand.NewSource(2223)) // Constant for reproducibility
+	const sLen = 30                        // Symbol length in characters
+	type Empty struct{}
+	var m1, m2 intern.StringMap[Empty]
+	for i := 0; i < b.N; i++ {
+		s := randomString(prng, sLen)
+		m1.Set(s, Empty{})
+		s = randomString(prng, sLen)
+		m2.Set(s, Empty{})
+	}
+
+	// Start the clock then merge the two maps into a third.
+	var m3 intern.StringMap[Empty]
+	b.ResetTimer()
+	m3.Merge(&m1)
+	m3.Merge(&m2)
+}
+
+// BenchmarkLookupEqBytes measures the time and memory needed to intern byte
+// slices whose contents were already interned as Eqs.  It should report zero
+// allocations per operation.
+func BenchmarkLookupEqBytes(b *testing.B) {
+	intern.ForgetAllEqs()
+	strs := generateRandomStrings(b.N)
+	_ = intern.NewEqMulti(strs)
+	bs := make([][]byte, len(strs))
+	for i, s := range strs {
+		bs[i] = []byte(s)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, s := range bs {
+		_ = intern.NewEqBytes(s)
+	}
+}
@@ -6,10 +6,16 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"math/rand"
+	"reflect"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"unsafe"
 
 	"github.com/spakin/intern"
 )
@@ -208,6 +214,25 @@ func TestEqMarshalJSON(t *testing.T) {
 	}
 }
 
+// TestEqMarshalInvalid tests that marshaling an invalid Eq, such as the zero
+// value, returns an ErrInvalid error instead of panicking.
+func TestEqMarshalInvalid(t *testing.T) {
+	intern.ForgetAllEqs()
+	var sym intern.Eq
+	if _, err := sym.MarshalText(); err == nil {
+		t.Fatal("MarshalText failed to reject an invalid Eq")
+	}
+	_, err := sym.MarshalBinary()
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrInvalid {
+		t.Fatalf("Expected an ErrInvalid error but saw %v", err)
+	}
+	_, err = json.Marshal(struct{ S intern.Eq }{})
+	var e *intern.PkgError
+	if !errors.As(err, &e) || e.Code != intern.ErrInvalid {
+		t.Fatalf("Expected an ErrInvalid error but saw %v", err)
+	}
+}
+
 // TestEqMarshalGob marshals Eqs to a gob and back and checks that the outputs
 // match the input.
 func TestEqMarshalGob(t *testing.T) {
@@ -250,3 +275,408 @@ func TestEqMarshalGob(t *testing.T) {
 		})
 	}
 }
+
+// TestAllEqs tests that we can iterate over all Eqs in allocation order.
+func TestAllEqs(t *testing.T) {
+	intern.ForgetAllEqs()
+	syms := intern.NewEqMulti(ozChars)
+	if n := intern.NumEqs(); n != len(ozChars) {
+		t.Fatalf("Expected %d Eqs but saw %d", len(ozChars), n)
+	}
+	i := 0
+	for sym, str := range intern.AllEqs() {
+		if sym != syms[i] || str != ozChars[i] {
+			t.Fatalf("Expected %d (%q) but saw %d (%q)", syms[i], ozChars[i], sym, str)
+		}
+		_ = intern.NewEq(str + " (copy)") // Should affect neither NumEqs nor AllEqs.
+		i++
+	}
+	if i != len(ozChars) {
+		t.Fatalf("Expected %d Eqs but saw %d", len(ozChars), i)
+	}
+}
+
+// TestWriteEqs tests that we can export all Eqs to an io.Writer.
+func TestWriteEqs(t *testing.T) {
+	intern.ForgetAllEqs()
+	syms := intern.NewEqMulti(ozChars)
+	var sb strings.Builder
+	err := intern.WriteEqs(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	if len(lines) != len(ozChars) {
+		t.Fatalf("Expected %d lines but saw %d", len(ozChars), len(lines))
+	}
+	for i, ln := range lines {
+		exp := strconv.FormatUint(uint64(syms[i]), 10) + "\t" + strconv.Quote(ozChars[i])
+		if ln != exp {
+			t.Fatalf("Expected %q but saw %q", exp, ln)
+		}
+	}
+}
+
+// TestEqBytes tests that we can intern byte slices as Eqs and that doing so
+// does not allocate memory when the string was already interned.
+func TestEqBytes(t *testing.T) {
+	intern.ForgetAllEqs()
+	defer intern.ForgetAllEqs()
+	syms := intern.NewEqMulti(ozChars)
+	bs := make([][]byte, len(ozChars))
+	for i, str := range ozChars {
+		bs[i] = []byte(str + " is a character in the Oz series of books")
+		syms[i] = intern.NewEqBytes(bs[i])
+		if syms[i].String() != string(bs[i]) {
+			t.Fatalf("Expected %q but saw %q", bs[i], syms[i])
+		}
+	}
+	if _, ok := intern.LookupEqBytes([]byte("Not an Oz character")); ok {
+		t.Fatal("Unexpectedly found a string that was never interned")
+	}
+	for _, frozen := range []bool{false, true} {
+		if frozen {
+			intern.FreezeEqs()
+		}
+		allocs := testing.AllocsPerRun(10, func() {
+			for i, b := range bs {
+				if intern.NewEqBytes(b) != syms[i] {
+					t.Fatalf("Failed to find %q", b)
+				}
+				if sym, ok := intern.LookupEqBytes(b); !ok || sym != syms[i] {
+					t.Fatalf("Failed to find %q", b)
+				}
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("Expected no allocations (frozen = %v) but saw %.1f", frozen, allocs)
+		}
+	}
+}
+
+// TestCanonical tests that Canonical returns a single, shared copy of each
+// string.
+func TestCanonical(t *testing.T) {
+	intern.ForgetAllEqs()
+	defer intern.ForgetAllEqs()
+	for _, frozen := range []bool{false, true} {
+		for _, str := range ozChars {
+			s1 := intern.Canonical(strings.Clone(str))
+			s2 := intern.Canonical(strings.Clone(str))
+			s3 := intern.CanonicalBytes([]byte(str))
+			if s1 != str || unsafe.StringData(s1) != unsafe.StringData(s2) || unsafe.StringData(s1) != unsafe.StringData(s3) {
+				t.Fatalf("Failed to canonicalize %q (frozen = %v)", str, frozen)
+			}
+		}
+		if intern.NumEqs() != len(ozChars) {
+			t.Fatalf("Expected %d Eqs but saw %d", len(ozChars), intern.NumEqs())
+		}
+		intern.FreezeEqs()
+	}
+	if s := intern.Canonical("Not an Oz character"); s != "Not an Oz character" {
+		t.Fatalf("Expected %q but saw %q", "Not an Oz character", s)
+	}
+}
+
+// TestForgetEq tests that individual strings can be forgotten and that doing
+// so releases canonical strings without disturbing other Eqs.
+func TestForgetEq(t *testing.T) {
+	intern.ForgetAllEqs()
+	defer intern.ForgetAllEqs()
+	syms := intern.NewEqMulti(ozChars[:10])
+	c1 := intern.Canonical(strings.Clone(ozChars[3]))
+	nb := intern.EqStats().Bytes
+	for _, i := range []int{3, 7, 3} {
+		if err := intern.ForgetEq(ozChars[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := intern.ForgetEq("Not an Oz character"); err != nil {
+		t.Fatal(err)
+	}
+	if n := intern.NumEqs(); n != 8 {
+		t.Fatalf("Expected 8 Eqs but saw %d", n)
+	}
+	if b := intern.EqStats().Bytes; b != nb-len(ozChars[3])-len(ozChars[7]) {
+		t.Fatalf("Expected %d bytes but saw %d", nb-len(ozChars[3])-len(ozChars[7]), b)
+	}
+	if _, ok := intern.LookupEq(ozChars[3]); ok {
+		t.Fatalf("Unexpectedly found forgotten string %q", ozChars[3])
+	}
+
+	// Ensure that a forgotten string receives a new Eq and a new
+	// canonical copy.
+	c2 := intern.Canonical(strings.Clone(ozChars[3]))
+	if c1 != c2 || unsafe.StringData(c1) == unsafe.StringData(c2) {
+		t.Fatalf("Expected a new canonical copy of %q", ozChars[3])
+	}
+	sym := intern.NewEq(ozChars[3])
+	if sym == syms[3] || sym <= syms[9] {
+		t.Fatalf("Expected a new Eq for %q but saw %d", ozChars[3], sym)
+	}
+	for i, s := range syms {
+		if i != 3 && i != 7 && s.String() != ozChars[i] {
+			t.Fatalf("Expected %q but saw %q", ozChars[i], s)
+		}
+	}
+
+	// Ensure that a table with forgotten strings can be exported and
+	// read back in.
+	var sb strings.Builder
+	if err := intern.WriteEqs(&sb); err != nil {
+		t.Fatal(err)
+	}
+	ms := intern.ExportEqs()
+	if err := intern.ReadEqs(strings.NewReader(sb.String())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ms, intern.ExportEqs()) {
+		t.Fatalf("Expected %v but saw %v", ms, intern.ExportEqs())
+	}
+	if s := intern.NewEq("Not an Oz character"); s <= sym {
+		t.Fatalf("Expected an Eq greater than %d but saw %d", sym, s)
+	}
+
+	// Ensure that strings cannot be forgotten from a frozen table.
+	intern.FreezeEqs()
+	if err := intern.ForgetEq(ozChars[0]); err == nil {
+		t.Fatal("ForgetEq unexpectedly succeeded on a frozen table")
+	}
+}
+
+// checkLimitError ensures that an error is a PkgError with code ErrLimit.
+func checkLimitError(t *testing.T, err error, str string) {
+	t.Helper()
+	e, ok := err.(*intern.PkgError)
+	if !ok || e.Code != intern.ErrLimit || e.Str != str {
+		t.Fatalf("Expected an ErrLimit error for %q but saw %v", str, err)
+	}
+}
+
+// TestEqLimits tests that the Eq table rejects new strings once its limits
+// are reached but continues to accept previously interned strings.
+func TestEqLimits(t *testing.T) {
+	intern.ForgetAllEqs()
+	defer intern.SetEqLimits(intern.Limits{})
+	defer intern.ForgetAllEqs()
+	intern.SetEqLimits(intern.Limits{MaxSymbols: 3, MaxBytes: 10, MaxLen: 5})
+	for _, str := range []string{"abc", "defg"} {
+		if _, err := intern.TryNewEq(str); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := intern.TryNewEq("tooLong")
+	checkLimitError(t, err, "tooLong")
+	_, err = intern.TryNewEq("hijk")
+	checkLimitError(t, err, "hijk")
+	if _, err = intern.TryNewEq("hij"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = intern.TryNewEq("x")
+	checkLimitError(t, err, "x")
+	if _, err = intern.TryNewEq("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if intern.NumEqs() != 3 {
+		t.Fatalf("Expected 3 Eqs but saw %d", intern.NumEqs())
+	}
+}
+
+// TestEqUnmarshalStrict tests that strict unmarshalling accepts previously
+// interned strings and rejects all others.
+func TestEqUnmarshalStrict(t *testing.T) {
+	intern.ForgetAllEqs()
+	syms := intern.NewEqMulti(ozChars[:10])
+	intern.SetEqUnmarshalStrict(true)
+	defer intern.SetEqUnmarshalStrict(false)
+	b, err := json.Marshal(ozChars[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var oSyms []intern.Eq
+	err = json.Unmarshal(b, &oSyms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, sym := range syms {
+		if oSyms[i] != sym {
+			t.Fatalf("Expected %d but saw %d", sym, oSyms[i])
+		}
+	}
+	b, err = json.Marshal(ozChars[5:15])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal(b, &oSyms)
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrUnknown || e.Str != ozChars[10] {
+		t.Fatalf("Expected an ErrUnknown error for %q but saw %v", ozChars[10], err)
+	}
+	if n := intern.NumEqs(); n != 10 {
+		t.Fatalf("Expected 10 Eqs but saw %d", n)
+	}
+}
+
+// eqRecord is a struct containing Eqs in various forms.
+type eqRecord struct {
+	Name  intern.Eq   `xml:"name,attr"`
+	Alias intern.Eq   `xml:"alias"`
+	Pair  []intern.Eq `xml:"pair"`
+}
+
+// eqRecords is a collection of eqRecords plus a map keyed by Eqs.
+type eqRecords struct {
+	XMLName xml.Name          `xml:"records" json:"-"`
+	Counts  map[intern.Eq]int `xml:"-"`
+	Recs    []eqRecord        `xml:"record"`
+}
+
+// checkEqRecords ensures that a eqRecords contains the expected strings.
+func checkEqRecords(t *testing.T, recs eqRecords, checkMap bool) {
+	t.Helper()
+	if len(recs.Recs) != len(ozChars) {
+		t.Fatalf("Expected %d records but saw %d", len(ozChars), len(recs.Recs))
+	}
+	for i, s := range ozChars {
+		r := recs.Recs[i]
+		s2 := ozChars[(i+1)%len(ozChars)]
+		if r.Name.String() != s || r.Alias.String() != s2 || len(r.Pair) != 2 || r.Pair[0].String() != s || r.Pair[1].String() != s2 {
+			t.Fatalf("Expected %q and %q but saw %q", s, s2, r)
+		}
+	}
+	if !checkMap {
+		return
+	}
+	if len(recs.Counts) != len(ozChars) {
+		t.Fatalf("Expected %d map entries but saw %d", len(ozChars), len(recs.Counts))
+	}
+	for sym, n := range recs.Counts {
+		if len(sym.String()) != n {
+			t.Fatalf("Expected %q to map to %d but saw %d", sym, len(sym.String()), n)
+		}
+	}
+}
+
+// TestEqMarshalShapes marshals Eqs that appear as map keys, array
+// elements, and fields of non-pointer structs to JSON and XML and back and
+// checks that the outputs match the input.
+func TestEqMarshalShapes(t *testing.T) {
+	for r, rStr := range []string{
+		"NoForget",
+		"Forget",
+	} {
+		t.Run(rStr, func(t *testing.T) {
+			// Create a collection of records.
+			intern.ForgetAllEqs()
+			syms := intern.NewEqMulti(ozChars)
+			in := eqRecords{Counts: make(map[intern.Eq]int, len(syms))}
+			for i, sym := range syms {
+				sym2 := syms[(i+1)%len(syms)]
+				in.Counts[sym] = len(ozChars[i])
+				in.Recs = append(in.Recs, eqRecord{
+					Name:  sym,
+					Alias: sym2,
+					Pair:  []intern.Eq{sym, sym2},
+				})
+			}
+
+			// Encode the records as JSON and as XML.  Pass the
+			// records by value so no Eq is addressable.
+			jb, err := json.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xb, err := xml.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(jb, []byte(strconv.Quote(ozChars[0])+":")) {
+				t.Fatalf("Expected %q to be encoded as a JSON map key", ozChars[0])
+			}
+
+			// On our second iteration, forget our entire mapping.
+			if r == 1 {
+				intern.ForgetAllEqs()
+			}
+
+			// Decode the records and ensure that they match the
+			// original strings.
+			var jOut, xOut eqRecords
+			err = json.Unmarshal(jb, &jOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEqRecords(t, jOut, true)
+			err = xml.Unmarshal(xb, &xOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkEqRecords(t, xOut, false)
+		})
+	}
+}
+
+// checkSyntaxError ensures that an error is a PkgError with code ErrSyntax
+// for a given line.
+func checkSyntaxError(t *testing.T, err error, line int) {
+	t.Helper()
+	e, ok := err.(*intern.PkgError)
+	if !ok || e.Code != intern.ErrSyntax || e.Line != line {
+		t.Fatalf("Expected an ErrSyntax error for line %d but saw %v", line, err)
+	}
+}
+
+// TestReadEqs tests that we can import Eqs exported by WriteEqs and that we
+// reject malformed input.
+func TestReadEqs(t *testing.T) {
+	intern.ForgetAllEqs()
+	syms := intern.NewEqMulti(ozChars)
+	var sb strings.Builder
+	err := intern.WriteEqs(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intern.ForgetAllEqs()
+	_ = intern.NewEq("Not an Oz character")
+	err = intern.ReadEqs(strings.NewReader("# Oz characters\n\n" + sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := intern.NumEqs(); n != len(ozChars) {
+		t.Fatalf("Expected %d Eqs but saw %d", len(ozChars), n)
+	}
+	for i, s := range ozChars {
+		if syms[i].String() != s {
+			t.Fatalf("Expected %q but saw %q", s, syms[i])
+		}
+	}
+
+	// Ensure that malformed input is rejected and leaves the table intact.
+	for _, c := range []struct {
+		text string
+		line int
+	}{
+		{"1\t\"a\"\n2\t\"b\n", 2},
+		{"1\t\"a\"\n# Comment\n1\t\"b\"\n", 3},
+		{"1\t\"a\"\n2\t\"a\"\n", 2},
+		{"3\t\"a\"\n2\t\"b\"\n", 2},
+		{"1\t\"a\"\t7\n", 1},
+		{"x\t\"a\"\n", 1},
+	} {
+		checkSyntaxError(t, intern.ReadEqs(strings.NewReader(c.text)), c.line)
+	}
+	if sym, ok := intern.LookupEq(ozChars[0]); !ok || sym != syms[0] {
+		t.Fatal("Malformed input modified the Eq table")
+	}
+
+	// Ensure that tables exceeding the limits are rejected.
+	intern.SetEqLimits(intern.Limits{MaxBytes: 3})
+	defer intern.SetEqLimits(intern.Limits{})
+	err = intern.ReadEqs(strings.NewReader("1\t\"ab\"\n2\t\"cd\"\n"))
+	checkLimitError(t, err, "cd")
+	if e := err.(*intern.PkgError); e.Line != 2 {
+		t.Fatalf("Expected line 2 but saw line %d", e.Line)
+	}
+	if sym, ok := intern.LookupEq(ozChars[0]); !ok || sym != syms[0] {
+		t.Fatal("An oversized table modified the Eq table")
+	}
+}
@@ -0,0 +1,280 @@
+// This file provides containers that are indexed directly by Eq symbols.
+
+package intern
+
+import (
+	"iter"
+	"math/bits"
+)
+
+// An EqSet is a set of Eqs.  Because Eqs are allocated densely, starting from
+// 1, an EqSet can be represented as a bitset, making membership tests and set
+// operations much faster than with a map[Eq]struct{}.  The memory consumed by
+// an EqSet is proportional to the largest Eq it has ever contained.  The zero
+// value is an empty set ready to use.
+type EqSet struct {
+	words []uint64 // Bit i of word j is set if Eq 64*j+i is present
+	n     int      // Number of Eqs in the set
+}
+
+// grow ensures an EqSet can represent a given Eq.
+func (s *EqSet) grow(e Eq) {
+	w := int(e / 64)
+	if w >= len(s.words) {
+		s.words = append(s.words, make([]uint64, w+1-len(s.words))...)
+	}
+}
+
+// Add adds an Eq to a set.
+func (s *EqSet) Add(e Eq) {
+	s.grow(e)
+	w, b := e/64, uint64(1)<<(e%64)
+	if s.words[w]&b == 0 {
+		s.words[w] |= b
+		s.n++
+	}
+}
+
+// Remove removes an Eq from a set.
+func (s *EqSet) Remove(e Eq) {
+	w, b := int(e/64), uint64(1)<<(e%64)
+	if w < len(s.words) && s.words[w]&b != 0 {
+		s.words[w] &^= b
+		s.n--
+	}
+}
+
+// Contains reports whether a set contains a given Eq.
+func (s *EqSet) Contains(e Eq) bool {
+	w := int(e / 64)
+	return w < len(s.words) && s.words[w]&(uint64(1)<<(e%64)) != 0
+}
+
+// Len returns the number of Eqs in a set.
+func (s *EqSet) Len() int {
+	return s.n
+}
+
+// All returns an iterator over all Eqs in a set in increasing order, which is
+// the order in which the Eqs were allocated.
+func (s *EqSet) All() iter.Seq[Eq] {
+	return func(yield func(Eq) bool) {
+		for j, w := range s.words {
+			for w != 0 {
+				i := bits.TrailingZeros64(w)
+				if !yield(Eq(64*j + i)) {
+					return
+				}
+				w &= w - 1
+			}
+		}
+	}
+}
+
+// recount recomputes the number of Eqs in a set.
+func (s *EqSet) recount() {
+	s.n = 0
+	for _, w := range s.words {
+		s.n += bits.OnesCount64(w)
+	}
+}
+
+// Clone returns a copy of a set.
+func (s *EqSet) Clone() *EqSet {
+	c := &EqSet{words: make([]uint64, len(s.words)), n: s.n}
+	copy(c.words, s.words)
+	return c
+}
+
+// UnionWith adds all of the Eqs in another set to a set.
+func (s *EqSet) UnionWith(t *EqSet) {
+	if len(t.words) > len(s.words) {
+		s.words = append(s.words, make([]uint64, len(t.words)-len(s.words))...)
+	}
+	for j, w := range t.words {
+		s.words[j] |= w
+	}
+	s.recount()
+}
+
+// IntersectWith removes from a set all Eqs not present in another set.
+func (s *EqSet) IntersectWith(t *EqSet) {
+	for j := range s.words {
+		if j < len(t.words) {
+			s.words[j] &= t.words[j]
+		} else {
+			s.words[j] = 0
+		}
+	}
+	s.recount()
+}
+
+// DifferenceWith removes from a set all Eqs present in another set.
+func (s *EqSet) DifferenceWith(t *EqSet) {
+	for j := range s.words {
+		if j < len(t.words) {
+			s.words[j] &^= t.words[j]
+		}
+	}
+	s.recount()
+}
+
+// Union returns a new set containing all Eqs present in either of two sets.
+func (s *EqSet) Union(t *EqSet) *EqSet {
+	u := s.Clone()
+	u.UnionWith(t)
+	return u
+}
+
+// Intersection returns a new set containing all Eqs present in both of two
+// sets.
+func (s *EqSet) Intersection(t *EqSet) *EqSet {
+	u := s.Clone()
+	u.IntersectWith(t)
+	return u
+}
+
+// Difference returns a new set containing all Eqs present in one set but not
+// in another.
+func (s *EqSet) Difference(t *EqSet) *EqSet {
+	u := s.Clone()
+	u.DifferenceWith(t)
+	return u
+}
+
+// An EqMap maps Eqs to values of an arbitrary type.  Because Eqs are
+// allocated densely, starting from 1, an EqMap can store its values in a slice
+// indexed directly by Eq, making lookups and updates much faster than with a
+// map[Eq]V.  The memory consumed by an EqMap is proportional to the largest Eq
+// it has ever contained.  The zero value is an empty map ready to use.
+type EqMap[V any] struct {
+	vals []V   // Value associated with each Eq
+	keys EqSet // Eqs that are present in the map
+}
+
+// Get returns the value associated with an Eq.  The second return value is
+// false if the Eq is not present in the map.
+func (m *EqMap[V]) Get(e Eq) (V, bool) {
+	if !m.keys.Contains(e) {
+		var zero V
+		return zero, false
+	}
+	return m.vals[e], true
+}
+
+// Set associates a value with an Eq.
+func (m *EqMap[V]) Set(e Eq, v V) {
+	if int(e) >= len(m.vals) {
+		n := int(e) + 1
+		if n < 2*len(m.vals) {
+			n = 2 * len(m.vals)
+		}
+		m.vals = append(m.vals, make([]V, n-len(m.vals))...)
+	}
+	m.vals[e] = v
+	m.keys.Add(e)
+}
+
+// Delete removes an Eq and its associated value from a map.
+func (m *EqMap[V]) Delete(e Eq) {
+	if m.keys.Contains(e) {
+		var zero V
+		m.vals[e] = zero
+		m.keys.Remove(e)
+	}
+}
+
+// Len returns the number of Eqs in a map.
+func (m *EqMap[V]) Len() int {
+	return m.keys.Len()
+}
+
+// Keys returns the set of Eqs present in a map.  The caller must not modify
+// the result.
+func (m *EqMap[V]) Keys() *EqSet {
+	return &m.keys
+}
+
+// All returns an iterator over all Eqs in a map and their associated values
+// in increasing order of Eq.
+func (m *EqMap[V]) All() iter.Seq2[Eq, V] {
+	return func(yield func(Eq, V) bool) {
+		for e := range m.keys.All() {
+			if !yield(e, m.vals[e]) {
+				return
+			}
+		}
+	}
+}
+
+// A StringMap maps strings to values of an arbitrary type.  It presents the
+// same interface as a map[string]V but interns its keys as Eqs and stores its
+// values in an EqMap.  Consequently, lookups and merges run at symbol speed,
+// and keys shared across many StringMaps are stored only once.  Because a
+// StringMap holds Eqs, neither ForgetAllEqs nor ForgetEq on any of its keys
+// may be called while a StringMap is in use.  The zero value is an empty map
+// ready to use.
+type StringMap[V any] struct {
+	m EqMap[V]
+}
+
+// Get returns the value associated with a string.  The second return value
+// is false if the string is not present in the map.  Get never interns a new
+// string.
+func (m *StringMap[V]) Get(s string) (V, bool) {
+	e, ok := LookupEq(s)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return m.m.Get(e)
+}
+
+// Set associates a value with a string.  Like NewEq, Set panics if the string
+// cannot be interned.
+func (m *StringMap[V]) Set(s string, v V) {
+	m.m.Set(NewEq(s), v)
+}
+
+// Delete removes a string and its associated value from a map.
+func (m *StringMap[V]) Delete(s string) {
+	if e, ok := LookupEq(s); ok {
+		m.m.Delete(e)
+	}
+}
+
+// Len returns the number of strings in a map.
+func (m *StringMap[V]) Len() int {
+	return m.m.Len()
+}
+
+// Merge copies all strings and their associated values from another map into
+// a map, replacing the values of any strings already present.
+func (m *StringMap[V]) Merge(o *StringMap[V]) {
+	for e, v := range o.m.All() {
+		m.m.Set(e, v)
+	}
+}
+
+// Range calls a function on each string in a map and its associated value
+// until the function returns false.  Strings are visited in the order in
+// which they were first interned.
+func (m *StringMap[V]) Range(f func(string, V) bool) {
+	for s, v := range m.All() {
+		if !f(s, v) {
+			return
+		}
+	}
+}
+
+// All returns an iterator over all strings in a map and their associated
+// values in the order in which the strings were first interned.
+func (m *StringMap[V]) All() iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		for e, v := range m.m.All() {
+			if !yield(e.String(), v) {
+				return
+			}
+		}
+	}
+}
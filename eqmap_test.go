@@ -0,0 +1,141 @@
+// This file provides unit tests for containers indexed by Eqs.
+
+package intern_test
+
+import (
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// makeEqSet constructs an EqSet from a list of strings.
+func makeEqSet(strs []string) *intern.EqSet {
+	var s intern.EqSet
+	for _, str := range strs {
+		s.Add(intern.NewEq(str))
+	}
+	return &s
+}
+
+// checkEqSet ensures that an EqSet contains exactly a given list of strings.
+func checkEqSet(t *testing.T, s *intern.EqSet, strs []string) {
+	t.Helper()
+	if s.Len() != len(strs) {
+		t.Fatalf("Expected %d Eqs but saw %d", len(strs), s.Len())
+	}
+	for _, str := range strs {
+		if !s.Contains(intern.NewEq(str)) {
+			t.Fatalf("Expected the set to contain %q", str)
+		}
+	}
+	n := 0
+	prev := intern.Eq(0)
+	for e := range s.All() {
+		if e <= prev {
+			t.Fatalf("Eqs %d and %d are out of order", prev, e)
+		}
+		prev = e
+		n++
+	}
+	if n != len(strs) {
+		t.Fatalf("Expected to iterate over %d Eqs but saw %d", len(strs), n)
+	}
+}
+
+// TestEqSet tests basic EqSet operations and set algebra.
+func TestEqSet(t *testing.T) {
+	intern.ForgetAllEqs()
+	a := makeEqSet(ozChars[:70])
+	b := makeEqSet(ozChars[50:])
+	checkEqSet(t, a, ozChars[:70])
+	checkEqSet(t, b, ozChars[50:])
+	checkEqSet(t, a.Union(b), ozChars)
+	checkEqSet(t, a.Intersection(b), ozChars[50:70])
+	checkEqSet(t, a.Difference(b), ozChars[:50])
+	checkEqSet(t, b.Difference(a), ozChars[70:])
+
+	// Ensure that removal works and is idempotent.
+	for _, str := range ozChars[:60] {
+		a.Remove(intern.NewEq(str))
+		a.Remove(intern.NewEq(str))
+	}
+	checkEqSet(t, a, ozChars[60:70])
+}
+
+// TestEqMap tests basic EqMap operations.
+func TestEqMap(t *testing.T) {
+	intern.ForgetAllEqs()
+	var m intern.EqMap[int]
+	for i, str := range ozChars {
+		m.Set(intern.NewEq(str), i)
+	}
+	for i, str := range ozChars[:10] {
+		m.Delete(intern.NewEq(str))
+		if _, ok := m.Get(intern.NewEq(str)); ok {
+			t.Fatalf("Failed to delete %q (%d)", str, i)
+		}
+	}
+	if m.Len() != len(ozChars)-10 {
+		t.Fatalf("Expected %d Eqs but saw %d", len(ozChars)-10, m.Len())
+	}
+	for i, str := range ozChars[10:] {
+		v, ok := m.Get(intern.NewEq(str))
+		if !ok || v != i+10 {
+			t.Fatalf("Expected %q to map to %d but saw %d", str, i+10, v)
+		}
+	}
+	n := 0
+	for e, v := range m.All() {
+		if e.String() != ozChars[v] {
+			t.Fatalf("Expected %d to map to %q but saw %q", v, ozChars[v], e)
+		}
+		n++
+	}
+	if n != m.Len() {
+		t.Fatalf("Expected to iterate over %d Eqs but saw %d", m.Len(), n)
+	}
+}
+
+// TestStringMap tests basic StringMap operations.
+func TestStringMap(t *testing.T) {
+	intern.ForgetAllEqs()
+	var m1, m2 intern.StringMap[int]
+	for i, str := range ozChars[:70] {
+		m1.Set(str, i)
+	}
+	for i, str := range ozChars[50:] {
+		m2.Set(str, -(i + 50))
+	}
+	if _, ok := m1.Get("Not an Oz character"); ok {
+		t.Fatal("Unexpectedly found a string that was never added")
+	}
+	if _, ok := intern.LookupEq("Not an Oz character"); ok {
+		t.Fatal("Get unexpectedly interned a string")
+	}
+	m1.Merge(&m2)
+	m1.Delete(ozChars[0])
+	m1.Delete(ozChars[0])
+	if m1.Len() != len(ozChars)-1 {
+		t.Fatalf("Expected %d strings but saw %d", len(ozChars)-1, m1.Len())
+	}
+	for i, str := range ozChars[1:] {
+		exp := i + 1
+		if exp >= 50 {
+			exp = -exp
+		}
+		if v, ok := m1.Get(str); !ok || v != exp {
+			t.Fatalf("Expected %q to map to %d but saw %d", str, exp, v)
+		}
+	}
+	n := 0
+	m1.Range(func(str string, v int) bool {
+		if str != ozChars[n+1] {
+			t.Fatalf("Expected %q but saw %q", ozChars[n+1], str)
+		}
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Fatalf("Expected 10 calls but saw %d", n)
+	}
+}
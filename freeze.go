@@ -0,0 +1,276 @@
+// This file provides support for freezing a symbol table into an immutable
+// form that can be read without locking.
+
+package intern
+
+import (
+	"fmt"
+	"sort"
+)
+
+// hashString hashes a string (or the string held in a slice of bytes) using a
+// given seed.  It implements the 64-bit FNV-1a hash function followed by a
+// finalization step that mixes the seed thoroughly into the result.
+func hashString[T string | []byte](seed uint64, s T) uint64 {
+	h := uint64(14695981039346656037) ^ (seed * 0x9e3779b97f4a7c15)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// An mph is a minimal perfect hash function, which maps each of n given
+// strings to a distinct integer in [0, n).  It uses the "hash, displace, and
+// compress" approach: Each string is first hashed into a bucket, then each
+// bucket is assigned a seed that causes all of its strings to hash into
+// distinct, unused slots.
+type mph struct {
+	seeds []int64 // Per-bucket seed (if positive) or -(slot+1) (if negative)
+}
+
+// newMPH constructs a minimal perfect hash function over a list of distinct
+// strings.
+func newMPH(keys []string) *mph {
+	// Hash each string into a bucket.
+	n := len(keys)
+	h := &mph{seeds: make([]int64, n)}
+	if n == 0 {
+		return h
+	}
+	buckets := make([][]string, n)
+	for _, k := range keys {
+		b := hashString(0, k) % uint64(n)
+		buckets[b] = append(buckets[b], k)
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return len(buckets[order[i]]) > len(buckets[order[j]])
+	})
+
+	// Find a seed for each multi-string bucket that maps all of the
+	// bucket's strings to unused slots.
+	used := make([]bool, n)
+	slots := make([]uint64, 0, len(buckets[order[0]]))
+	var i int
+	for i = 0; i < n && len(buckets[order[i]]) > 1; i++ {
+		b := order[i]
+	TrySeed:
+		for seed := int64(1); ; seed++ {
+			slots = slots[:0]
+			for _, k := range buckets[b] {
+				s := hashString(uint64(seed), k) % uint64(n)
+				if used[s] {
+					continue TrySeed
+				}
+				for _, s2 := range slots {
+					if s == s2 {
+						continue TrySeed
+					}
+				}
+				slots = append(slots, s)
+			}
+			for _, s := range slots {
+				used[s] = true
+			}
+			h.seeds[b] = seed
+			break
+		}
+	}
+
+	// Place each remaining single-string bucket directly in an unused
+	// slot.
+	free := 0
+	for ; i < n && len(buckets[order[i]]) == 1; i++ {
+		for used[free] {
+			free++
+		}
+		used[free] = true
+		h.seeds[order[i]] = -int64(free) - 1
+	}
+	return h
+}
+
+// lookup returns the slot associated with a string.  If the string was not
+// one of those used to construct the hash function, the slot is arbitrary.
+func (h *mph) lookup(s string) int {
+	return mphSlot(h, s)
+}
+
+// mphSlot performs the work of mph.lookup for either a string or a slice of
+// bytes, which lets lookupBytes avoid converting its argument to a string.
+func mphSlot[T string | []byte](h *mph, s T) int {
+	n := uint64(len(h.seeds))
+	seed := h.seeds[hashString(0, s)%n]
+	if seed < 0 {
+		return int(-seed - 1)
+	}
+	return int(hashString(uint64(seed), s) % n)
+}
+
+// A frozenTable is an immutable mapping between strings and symbols.
+type frozenTable struct {
+	hash *mph     // Mapping from strings to slots
+	keys []string // Strings, indexed by slot
+	vals []symbol // Symbols, indexed by slot
+	syms []symbol // All symbols in increasing order
+	strs []string // Strings corresponding to each element of syms
+}
+
+// newFrozenTable constructs a frozenTable from a mapping of symbols to
+// strings.
+func newFrozenTable(symToStr map[symbol]string) *frozenTable {
+	// Sort the symbols.
+	n := len(symToStr)
+	ft := &frozenTable{
+		keys: make([]string, n),
+		vals: make([]symbol, n),
+		syms: make([]symbol, 0, n),
+		strs: make([]string, n),
+	}
+	for sym := range symToStr {
+		ft.syms = append(ft.syms, sym)
+	}
+	sort.Sort(symbolList(ft.syms))
+	for i, sym := range ft.syms {
+		ft.strs[i] = symToStr[sym]
+	}
+
+	// Hash the strings.
+	ft.hash = newMPH(ft.strs)
+	for i, str := range ft.strs {
+		s := ft.hash.lookup(str)
+		ft.keys[s] = str
+		ft.vals[s] = ft.syms[i]
+	}
+	return ft
+}
+
+// lookup returns the symbol associated with a string and a success flag.
+func (ft *frozenTable) lookup(s string) (symbol, bool) {
+	if len(ft.keys) == 0 {
+		return 0, false
+	}
+	i := ft.hash.lookup(s)
+	if ft.keys[i] != s {
+		return 0, false
+	}
+	return ft.vals[i], true
+}
+
+// lookupBytes is like lookup but accepts a slice of bytes.  It does not
+// allocate memory.
+func (ft *frozenTable) lookupBytes(b []byte) (symbol, bool) {
+	if len(ft.keys) == 0 {
+		return 0, false
+	}
+	i := mphSlot(ft.hash, b)
+	if ft.keys[i] != string(b) {
+		return 0, false
+	}
+	return ft.vals[i], true
+}
+
+// toString returns the string associated with a symbol and a success flag.
+func (ft *frozenTable) toString(sym symbol) (string, bool) {
+	// Symbols allocated densely starting from 1 (i.e., Eqs) can be
+	// found directly.
+	if i := int(sym - 1); i >= 0 && i < len(ft.syms) && ft.syms[i] == sym {
+		return ft.strs[i], true
+	}
+
+	// All other symbols (e.g., LGEs) require a binary search.
+	i := sort.Search(len(ft.syms), func(i int) bool { return ft.syms[i] >= sym })
+	if i < len(ft.syms) && ft.syms[i] == sym {
+		return ft.strs[i], true
+	}
+	return "", false
+}
+
+// frozenSymbol returns the symbol associated with a string in a frozen table
+// or an error if the string was not interned before the table was frozen.
+func (st *state) frozenSymbol(s, ty string) (symbol, error) {
+	sym, ok := st.frozen.Load().lookup(s)
+	if !ok {
+		st.counts.failures.Add(1)
+		return 0, &PkgError{
+			Code: ErrFrozen,
+			Str:  s,
+			msg:  fmt.Sprintf("Unable to intern %q; the %s table is frozen", s, ty),
+		}
+	}
+	st.counts.hits.Add(1)
+	return sym, nil
+}
+
+// frozenError returns an error indicating that a table cannot be modified
+// because it is frozen.
+func frozenError(ty string) error {
+	return &PkgError{
+		Code: ErrFrozen,
+		msg:  fmt.Sprintf("The %s table is frozen", ty),
+	}
+}
+
+// FreezeEqs converts the Eq table into an immutable form.  Once frozen, the
+// Eq table supports lookups and conversions of Eqs to strings without
+// acquiring any locks, and string-to-Eq lookups use a minimal perfect hash
+// function instead of a Go map.  NewEq and TryNewEq continue to work for
+// strings that were interned before the table was frozen, but interning a new
+// string makes NewEq panic and TryNewEq return a PkgError with code ErrFrozen.
+// ForgetAllEqs discards all mappings and unfreezes the Eq table.  FreezeEqs
+// releases the Go maps the Eq table uses while unfrozen, so a frozen table
+// occupies roughly the same amount of memory as an unfrozen one.
+func FreezeEqs() {
+	eq.lock()
+	defer eq.Unlock()
+	if eq.frozen.Load() != nil {
+		return
+	}
+	eq.frozen.Store(newFrozenTable(eq.symToStr))
+	eq.releaseMaps()
+}
+
+// FreezeLGEs converts the LGE table into an immutable form.  All strings
+// passed to PreLGE are first mapped to LGEs.  Any that would exceed the
+// limits set with SetLGELimits or that do not fit are discarded, in which
+// case FreezeLGEs returns a PkgError describing the first such string, but
+// the table is frozen regardless.  Once frozen, the LGE table supports
+// lookups and conversions of LGEs to strings without acquiring any locks, and
+// string-to-LGE lookups use a minimal perfect hash function instead of a Go
+// map.  NewLGE continues to work for strings that were interned before the
+// table was frozen, but it returns a PkgError with code ErrFrozen when given
+// a new string.  The RemapAllLGEs family of functions likewise returns an
+// ErrFrozen PkgError, and PreLGE and PreLGEMulti silently discard their
+// arguments.  ForgetAllLGEs discards all mappings and unfreezes the LGE
+// table.  FreezeLGEs releases the Go maps the LGE table uses while unfrozen
+// but retains the tree that supports ordered queries such as AllLGEs and
+// LGE.Rank, so a frozen LGE table occupies roughly the same amount of memory
+// as an unfrozen one.
+func FreezeLGEs() error {
+	lge.lock()
+	defer lge.Unlock()
+	if lge.frozen.Load() != nil {
+		return nil
+	}
+	err := firstError(lge.flushPending())
+	lge.frozen.Store(newFrozenTable(lge.symToStr))
+	lge.releaseMaps()
+	return err
+}
+
+// releaseMaps replaces a frozen table's string/symbol maps with empty maps
+// so their memory can be reclaimed.  All readers consult the frozenTable
+// instead of the maps once the table is frozen.
+func (st *state) releaseMaps() {
+	st.symToStr = make(map[symbol]string)
+	st.strToSym = make(map[string]symbol)
+}
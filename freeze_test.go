@@ -0,0 +1,217 @@
+// This file provides unit tests for frozen symbol tables.
+
+package intern_test
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// expectFrozen ensures that an error is a PkgError with code ErrFrozen.
+func expectFrozen(t *testing.T, err error) {
+	t.Helper()
+	e, ok := err.(*intern.PkgError)
+	if !ok || e.Code != intern.ErrFrozen {
+		t.Fatalf("Expected an ErrFrozen PkgError but saw %v", err)
+	}
+}
+
+// TestFreezeEqs tests that a frozen Eq table supports lookups but not new
+// allocations.
+func TestFreezeEqs(t *testing.T) {
+	// Intern a large number of strings then freeze the table.
+	intern.ForgetAllEqs()
+	defer intern.ForgetAllEqs()
+	strs := generateRandomStrings(100000)
+	syms := intern.NewEqMulti(strs)
+	intern.FreezeEqs()
+
+	// Ensure that every string and symbol can be found.
+	for i, s := range strs {
+		if sym := intern.NewEq(s); sym != syms[i] {
+			t.Fatalf("Expected %q to map to %d but saw %d", s, syms[i], sym)
+		}
+		if sym, ok := intern.LookupEq(s); !ok || sym != syms[i] {
+			t.Fatalf("Expected %q to map to %d but saw %d", s, syms[i], sym)
+		}
+		if str := syms[i].String(); str != s {
+			t.Fatalf("Expected %d to map to %q but saw %q", syms[i], s, str)
+		}
+	}
+
+	// Ensure that freezing twice changes nothing and that the frozen table
+	// can still be counted and exported.
+	intern.FreezeEqs()
+	if n := intern.NumEqs(); n != len(syms) {
+		t.Fatalf("Expected %d Eqs but saw %d", len(syms), n)
+	}
+	if n := intern.EqStats().Symbols; n != len(syms) {
+		t.Fatalf("Expected statistics for %d Eqs but saw %d", len(syms), n)
+	}
+	for i, m := range intern.ExportEqs() {
+		if m.Sym != syms[i] || m.Str != strs[i] {
+			t.Fatalf("Expected {%d %q} but saw {%d %q}", syms[i], strs[i], m.Sym, m.Str)
+		}
+	}
+
+	// Ensure that new strings are rejected.
+	if _, ok := intern.LookupEq("Not a random string"); ok {
+		t.Fatal("Unexpectedly found an uninterned string")
+	}
+	_, err := intern.TryNewEq("Not a random string")
+	expectFrozen(t, err)
+	func() {
+		defer func() {
+			r := recover()
+			err, _ := r.(error)
+			expectFrozen(t, err)
+		}()
+		_ = intern.NewEq("Not a random string")
+	}()
+
+	// Ensure that forgetting all Eqs unfreezes the table.
+	intern.ForgetAllEqs()
+	_, err = intern.TryNewEq("Not a random string")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFreezeLGEs tests that a frozen LGE table supports lookups but not new
+// allocations.
+func TestFreezeLGEs(t *testing.T) {
+	// Intern some strings then freeze the table.
+	intern.ForgetAllLGEs()
+	defer intern.ForgetAllLGEs()
+	syms, err := intern.NewLGEMulti(ozChars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	intern.PreLGE("Zzyzx")
+	err = intern.FreezeLGEs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure that every string and symbol can be found, including
+	// strings that were only pre-allocated.
+	for i, s := range ozChars {
+		sym, err := intern.NewLGE(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sym != syms[i] {
+			t.Fatalf("Expected %q to map to %d but saw %d", s, syms[i], sym)
+		}
+		if str := sym.String(); str != s {
+			t.Fatalf("Expected %d to map to %q but saw %q", sym, s, str)
+		}
+	}
+	if _, ok := intern.LookupLGE("Zzyzx"); !ok {
+		t.Fatal("Failed to find a pre-allocated string")
+	}
+
+	// Ensure that new strings and remaps are rejected.
+	_, err = intern.NewLGE("Not an Oz character")
+	expectFrozen(t, err)
+	_, err = intern.RemapAllLGEs()
+	expectFrozen(t, err)
+
+	// Ensure that pre-allocation is ignored and that freezing twice
+	// changes nothing.
+	intern.PreLGE("Not an Oz character")
+	if p := intern.LGEStats().Pending; p != 0 {
+		t.Fatalf("Expected no pending strings but saw %d", p)
+	}
+	if err = intern.FreezeLGEs(); err != nil {
+		t.Fatal(err)
+	}
+	if n := intern.NumLGEs(); n != len(ozChars)+1 {
+		t.Fatalf("Expected %d LGEs but saw %d", len(ozChars)+1, n)
+	}
+}
+
+// TestFreezeLGEsLimit ensures that FreezeLGEs freezes the LGE table even when
+// it must discard pending strings that exceed the table's limits.
+func TestFreezeLGEsLimit(t *testing.T) {
+	intern.ForgetAllLGEs()
+	intern.SetLGELimits(intern.Limits{MaxLen: 3})
+	defer func() {
+		intern.SetLGELimits(intern.Limits{})
+		intern.ForgetAllLGEs()
+	}()
+	intern.PreLGE("abcdef")
+	intern.PreLGE("ab")
+	err := intern.FreezeLGEs()
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrLimit || e.Str != "abcdef" {
+		t.Fatalf("Expected an ErrLimit error for %q but saw %v", "abcdef", err)
+	}
+	if _, ok := intern.LookupLGE("ab"); !ok {
+		t.Fatalf("Expected %q to be interned", "ab")
+	}
+	if _, ok := intern.LookupLGE("abcdef"); ok {
+		t.Fatalf("Expected %q to be discarded", "abcdef")
+	}
+	_, err = intern.NewLGE("cd")
+	expectFrozen(t, err)
+	if err = intern.FreezeLGEs(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestFreezeWhileReading freezes the Eq table while other goroutines are
+// reading it in an attempt to expose race conditions.
+func TestFreezeWhileReading(t *testing.T) {
+	intern.ForgetAllEqs()
+	defer intern.ForgetAllEqs()
+	strs := generateRandomStrings(1000)
+	syms := intern.NewEqMulti(strs)
+	nThreads := runtime.NumCPU()
+	done := make(chan bool, nThreads)
+	for j := 0; j < nThreads; j++ {
+		go func() {
+			for i, s := range strs {
+				if sym, ok := intern.LookupEq(s); !ok || sym != syms[i] || sym.String() != s {
+					t.Errorf("Incorrect mapping for %q", s)
+					break
+				}
+			}
+			done <- true
+		}()
+	}
+	intern.FreezeEqs()
+	for j := 0; j < nThreads; j++ {
+		_ = <-done
+	}
+}
+
+// TestFrozenConcurrent performs a bunch of lookups in parallel in an attempt
+// to expose race conditions.
+func TestFrozenConcurrent(t *testing.T) {
+	intern.ForgetAllEqs()
+	defer intern.ForgetAllEqs()
+	strs := generateRandomStrings(10000)
+	syms := intern.NewEqMulti(strs)
+	intern.FreezeEqs()
+	nThreads := runtime.NumCPU() * 2 // Oversubscribe CPUs by a factor of 2.
+	done := make(chan bool, nThreads)
+	for j := 0; j < nThreads; j++ {
+		go func(seed int64) {
+			prng := rand.New(rand.NewSource(seed))
+			for i := 0; i < 10000; i++ {
+				k := prng.Intn(len(strs))
+				if intern.NewEq(strs[k]) != syms[k] || syms[k].String() != strs[k] {
+					t.Errorf("Incorrect mapping for %q", strs[k])
+					break
+				}
+			}
+			done <- true
+		}(int64(j))
+	}
+	for j := 0; j < nThreads; j++ {
+		_ = <-done
+	}
+}
@@ -31,8 +31,12 @@ original string.  Ergo, no information is lost when mapping strings to symbols.
 Usage
 
 NewEq maps a string to an Eq symbol, and NewLGE maps a string to an LGE symbol.
-The former is faster and always succeeds (until the set of 64-bit integers is
-exhausted).  NewLGE, in addition to being slower, can fail if earlier
+The former is faster and ordinarily succeeds (until the set of 64-bit integers
+is exhausted).  However, NewEq, NewEqMulti, NewEqBytes, and StringMap.Set
+panic when given a new string if the Eq table has been frozen with FreezeEqs
+or if interning the string would exceed the limits set with SetEqLimits.
+TryNewEq and TryNewEqBytes return a PkgError in those cases instead of
+panicking.  NewLGE, in addition to being slower, can fail if earlier
 assignments of integers to strings preclude a new string from being mapped to
 an integer that respects comparisons with all existing symbols.  (In the
 current implementation, a worst-case sequence of NewLGE calls will fail on the
@@ -46,9 +50,20 @@ assigned integers in an order that helps ensure that the desired relations are
 preserved.  The process of pre-allocating LGE symbols with PreLGE and later
 allocating them with NewLGE can be repeated as many times as necessary but with
 increasing likelihood of failure with each repetition.  If NewLGE does fail,
-the RemapAllLGEs function can be called to completely redo the mapping from
-strings to LGE symbols.  The program will need to update any live LGE symbols
-it has stored in data structures.
+the failed string can be passed to PreLGE, and the RemapSomeLGEs function can
+be called to reassign symbols to only those strings that lie near the failed
+string, or the RemapAllLGEs function can be called to completely redo the
+mapping from strings to LGE symbols.  RemapAllLGEsMinimal also redoes the
+complete mapping but tries to keep existing LGEs.  Either way, the program will
+need to update any live LGE symbols it has stored in data structures.  The
+LGESortedSet, LGESortedMap, and LGEQueue containers update their own LGEs
+automatically, but they never remap the LGE table themselves, so a full table
+makes them return an error, too.
+
+Programs that finish interning strings before using the resulting symbols can
+call FreezeEqs and FreezeLGEs to convert the Eq and LGE tables to an immutable
+form that can be read without locking.  Once frozen, a table rejects attempts
+to intern new strings.
 
 All functions in this package are thread-safe.
 
@@ -90,14 +105,27 @@ performs at least as many comparisons as symbol allocations.
 package intern
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // These constants represent the various error codes the package can return.
 const (
 	ErrTableFull   = iota + 1 // Symbol table is full
 	ErrRemapFailed            // Symbol remapping failed
+	ErrFrozen                 // Symbol table is frozen
+	ErrLimit                  // Symbol table limit would be exceeded
+	ErrUnknown                // String was not previously interned
+	ErrSyntax                 // Malformed textual table
+	ErrInvalid                // Symbol was never assigned to a string
+	ErrCorrupt                // Malformed binary stream
 )
 
 // PkgError represents an error specific to the intern package, as opposed to
@@ -105,6 +133,7 @@ const (
 type PkgError struct {
 	Code int    // Type of error that occurred
 	Str  string // String that triggered the error (if applicable)
+	Line int    // Input line that triggered the error (if applicable)
 	msg  string // Textual description of the error
 }
 
@@ -113,6 +142,16 @@ func (e *PkgError) Error() string {
 	return e.msg
 }
 
+// Limits bounds the growth of a symbol table.  A zero-valued field imposes no
+// limit.  Strings that would cause a table to exceed its limits are rejected
+// with a PkgError with code ErrLimit, but strings that were interned before
+// the limits were set remain interned and can still be looked up.
+type Limits struct {
+	MaxSymbols int // Maximum number of strings in the table
+	MaxBytes   int // Maximum total length in bytes of all strings in the table
+	MaxLen     int // Maximum length in bytes of an individual string
+}
+
 // symbol represents either package symbol type (Eq or LGE).
 type symbol uint64
 
@@ -134,7 +173,16 @@ type state struct {
 	strToSym     map[string]symbol // Mapping from strings to symbols
 	tree         *tree             // Tree for maintaining symbols assignments
 	pending      []string          // Strings not yet mapped to symbols
+	nbytes       int               // Total length of all strings in strToSym
+	last         symbol            // Last symbol assigned by assignNext
+	limits       Limits            // Bounds on the size of the table
 	sync.RWMutex                   // Mutex protecting all of the above
+
+	frozen atomic.Pointer[frozenTable] // Immutable form of the above or nil
+	gen    atomic.Uint64               // Incremented when symbols are reassigned or forgotten
+	strict atomic.Bool                 // true if unmarshalling never interns
+	sqlNum atomic.Bool                 // true if SQL values are symbols, not strings
+	counts counters                    // Usage statistics
 }
 
 // forgetAll discards all extant string/symbol mappings and resets the
@@ -144,36 +192,511 @@ func (st *state) forgetAll() {
 	st.strToSym = make(map[string]symbol)
 	st.tree = nil
 	st.pending = make([]string, 0, 100)
+	st.nbytes = 0
+	st.last = 0
+	st.frozen.Store(nil)
+	st.gen.Add(1)
+}
+
+// str returns the string associated with a symbol and a success flag.
+func (st *state) str(s symbol) (string, bool) {
+	if ft := st.frozen.Load(); ft != nil {
+		return ft.toString(s)
+	}
+	st.RLock()
+	defer st.RUnlock()
+	if ft := st.frozen.Load(); ft != nil {
+		return ft.toString(s) // Frozen (and the maps released) while we waited
+	}
+	str, ok := st.symToStr[s]
+	return str, ok
 }
 
 // toString converts a symbol back to a string.  It panics if given a symbol
 // that was not created using New*.
 func (st *state) toString(s symbol, ty string) string {
+	str, ok := st.str(s)
+	if !ok {
+		panic(fmt.Sprintf("%d is not a valid intern.%s", s, ty))
+	}
+	return str
+}
+
+// checkedString is like toString but returns a PkgError with code ErrInvalid
+// instead of panicking if given an invalid symbol, such as the zero value.
+func (st *state) checkedString(s symbol, ty string) (string, error) {
+	str, ok := st.str(s)
+	if !ok {
+		return "", &PkgError{
+			Code: ErrInvalid,
+			msg:  fmt.Sprintf("%d is not a valid intern.%s", s, ty),
+		}
+	}
+	return str, nil
+}
+
+// marshal converts a symbol to a slice of bytes containing its string.
+func (st *state) marshal(s symbol, ty string) ([]byte, error) {
+	str, err := st.checkedString(s, ty)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(str), nil
+}
+
+// valid reports whether a symbol has been assigned to a string.
+func (st *state) valid(s symbol) bool {
+	_, ok := st.str(s)
+	return ok
+}
+
+// lookup returns the symbol associated with a string and a success flag.
+// It never allocates a new symbol.
+func (st *state) lookup(s string) (symbol, bool) {
+	if ft := st.frozen.Load(); ft != nil {
+		return ft.lookup(s)
+	}
+	st.RLock()
+	defer st.RUnlock()
+	if ft := st.frozen.Load(); ft != nil {
+		return ft.lookup(s) // Frozen (and the maps released) while we waited
+	}
+	sym, ok := st.strToSym[s]
+	return sym, ok
+}
+
+// lookupBytes is like lookup but accepts a slice of bytes.  It does not
+// allocate memory.
+func (st *state) lookupBytes(b []byte) (symbol, bool) {
+	if ft := st.frozen.Load(); ft != nil {
+		return ft.lookupBytes(b)
+	}
 	st.RLock()
 	defer st.RUnlock()
-	if str, ok := st.symToStr[s]; ok {
-		return str
+	if ft := st.frozen.Load(); ft != nil {
+		return ft.lookupBytes(b) // Frozen (and the maps released) while we waited
+	}
+	sym, ok := st.strToSym[string(b)] // The compiler elides the conversion.
+	return sym, ok
+}
+
+// hasPending reports whether any strings are awaiting symbols.
+func (st *state) hasPending() bool {
+	if st.frozen.Load() != nil {
+		return false // Freezing flushes pending strings and ignores new ones.
+	}
+	st.RLock()
+	defer st.RUnlock()
+	return len(st.pending) > 0
+}
+
+// size returns the number of strings in a table.  The caller must hold at
+// least a read lock.
+func (st *state) size() int {
+	if ft := st.frozen.Load(); ft != nil {
+		return len(ft.syms)
+	}
+	return len(st.symToStr)
+}
+
+// admit returns a PkgError if interning a list of strings would exceed the
+// table's limits.  Strings that are already interned are not counted.
+func (st *state) admit(ss []string, ty string) error {
+	lim := st.limits
+	if lim == (Limits{}) {
+		return nil
+	}
+	var seen map[string]bool
+	if len(ss) > 1 {
+		seen = make(map[string]bool, len(ss))
+	}
+	n, nb := len(st.strToSym), st.nbytes
+	for _, s := range ss {
+		if _, ok := st.strToSym[s]; ok || seen[s] {
+			continue
+		}
+		if seen != nil {
+			seen[s] = true
+		}
+		n++
+		nb += len(s)
+		if e := st.limitError(s, n, nb, ty); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+// limitError returns a PkgError if a table that holds n strings totaling nb
+// bytes, the last of which is s, would exceed the table's limits.  It returns
+// nil otherwise.
+func (st *state) limitError(s string, n, nb int, ty string) *PkgError {
+	lim := st.limits
+	var why string
+	switch {
+	case lim.MaxLen > 0 && len(s) > lim.MaxLen:
+		why = fmt.Sprintf("strings are limited to %d bytes", lim.MaxLen)
+	case lim.MaxSymbols > 0 && n > lim.MaxSymbols:
+		why = fmt.Sprintf("the %s table is limited to %d strings", ty, lim.MaxSymbols)
+	case lim.MaxBytes > 0 && nb > lim.MaxBytes:
+		why = fmt.Sprintf("the %s table is limited to %d bytes", ty, lim.MaxBytes)
+	default:
+		return nil
+	}
+	return &PkgError{
+		Code: ErrLimit,
+		Str:  s,
+		msg:  fmt.Sprintf("Unable to intern %q; %s", s, why),
+	}
+}
+
+// admitPending discards from the pending list each string whose interning
+// would exceed the table's limits and returns a PkgError for each such
+// string.  All other pending strings, including those queued by other
+// callers, remain pending.
+func (st *state) admitPending(ty string) []*PkgError {
+	if st.limits == (Limits{}) {
+		return nil
+	}
+	var errs []*PkgError
+	seen := make(map[string]bool, len(st.pending))
+	n, nb := len(st.strToSym), st.nbytes
+	kept := st.pending[:0]
+	for _, s := range st.pending {
+		if _, ok := st.strToSym[s]; !ok && !seen[s] {
+			if e := st.limitError(s, n+1, nb+len(s), ty); e != nil {
+				errs = append(errs, e)
+				continue
+			}
+			seen[s] = true
+			n++
+			nb += len(s)
+		}
+		kept = append(kept, s)
+	}
+	st.pending = kept
+	return errs
+}
+
+// firstError returns the first error in a list or nil if the list is empty.
+func firstError(errs []*PkgError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+// errorFor returns the error in a list that pertains to a given string or
+// nil if there is no such error.
+func errorFor(errs []*PkgError, s string) error {
+	for _, e := range errs {
+		if e.Str == s {
+			return e
+		}
+	}
+	return nil
+}
+
+// admitTable returns a PkgError if replacing a table's contents with a list of
+// entries would exceed the table's limits.  The error indicates the line of
+// the first entry that exceeds a limit.
+func (st *state) admitTable(ents []tableEntry, ty string) error {
+	if st.limits == (Limits{}) {
+		return nil
+	}
+	byLine := make([]tableEntry, len(ents))
+	copy(byLine, ents)
+	sort.Slice(byLine, func(i, j int) bool { return byLine[i].line < byLine[j].line })
+	nb := 0
+	for i, ent := range byLine {
+		nb += len(ent.str)
+		if e := st.limitError(ent.str, i+1, nb, ty); e != nil {
+			e.Line = ent.line
+			e.msg = fmt.Sprintf("Line %d: %s", ent.line, e.msg)
+			return e
+		}
 	}
-	panic(fmt.Sprintf("%d is not a valid intern.%s", s, ty))
+	return nil
+}
+
+// unmarshal converts a slice of bytes to a symbol.  If the table is in
+// strict unmarshalling mode, unmarshal only looks up previously interned
+// strings and returns a PkgError with code ErrUnknown for all others.
+// Otherwise, it calls a given function to intern the string.
+func (st *state) unmarshal(b []byte, ty string, assign func(string) (symbol, error)) (symbol, error) {
+	if !st.strict.Load() {
+		return assign(string(b))
+	}
+	sym, ok := st.lookupBytes(b)
+	if !ok {
+		s := string(b)
+		return 0, &PkgError{
+			Code: ErrUnknown,
+			Str:  s,
+			msg:  fmt.Sprintf("Unable to unmarshal %q; it is not an interned %s", s, ty),
+		}
+	}
+	return sym, nil
 }
 
 // flushPending flushes all pending symbols, converting strings to symbols.
-// The function returns an error status.
-func (st *state) flushPending() error {
-	var err error
-	if len(st.pending) > 0 {
-		var sMap map[string]symbol
-		st.tree, sMap, err = st.tree.insertMany(st.pending)
+// Strings that would exceed the table's limits or for which the tree has no
+// room are discarded, and the rest are still flushed.  The pending list is
+// always empty on return.  flushPending returns a PkgError for each discarded
+// string.
+func (st *state) flushPending() []*PkgError {
+	if len(st.pending) == 0 {
+		return nil
+	}
+	errs := st.admitPending("LGE")
+	for len(st.pending) > 0 {
+		tNew, sMap, err := st.tree.insertMany(st.pending)
 		if err != nil {
-			return err
+			// Discard the string that did not fit and try again
+			// with the remaining strings.
+			st.tree = tNew.prune(st.pending, st.strToSym)
+			e := err.(*PkgError)
+			errs = append(errs, e)
+			st.pending = slices.DeleteFunc(st.pending, func(s string) bool { return s == e.Str })
+			continue
 		}
+		st.tree = tNew
 		st.pending = st.pending[:0]
 		for k, v := range sMap {
+			if _, ok := st.strToSym[k]; !ok {
+				st.nbytes += len(k)
+			}
 			st.strToSym[k] = v
 			st.symToStr[v] = k
 		}
 	}
-	return nil
+	return errs
+}
+
+// relabelPending flushes all pending symbols, converting strings to symbols.
+// Unlike flushPending, relabelPending makes room for strings that do not fit
+// by reassigning the symbols of a few nearby strings.  The function returns a
+// map from old to new symbols for all previously mapped strings whose symbols
+// changed plus an error status.  The map is valid even when the error is
+// non-nil because strings inserted before the failure keep their new symbols.
+func (st *state) relabelPending() (map[symbol]symbol, error) {
+	err := firstError(st.admitPending("LGE"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Sort the pending strings so we can insert them in an order that
+	// helps keep the tree balanced.
+	ss := make([]string, len(st.pending))
+	copy(ss, st.pending)
+	sort.Strings(ss)
+
+	// Insert each string in turn, remembering the original symbol of each
+	// string we relabel.
+	orig := make(map[string]symbol)
+	added := make(map[string]bool)
+	insertOne := func(s string) error {
+		if _, ok := st.strToSym[s]; ok {
+			return nil
+		}
+		added[s] = true
+		tNew, sMap, err := st.tree.insertRelabel(s)
+		st.tree = tNew
+		if err != nil {
+			return err
+		}
+		st.nbytes += len(s)
+		for str := range sMap {
+			old, ok := st.strToSym[str]
+			if !ok {
+				continue
+			}
+			if _, seen := orig[str]; !seen && !added[str] {
+				orig[str] = old
+			}
+			delete(st.symToStr, old)
+		}
+		for str, sym := range sMap {
+			st.strToSym[str] = sym
+			st.symToStr[sym] = str
+		}
+		return nil
+	}
+	var insert func(ss []string) error
+	insert = func(ss []string) error {
+		if len(ss) == 0 {
+			return nil
+		}
+		mid := len(ss) / 2
+		err := insertOne(ss[mid])
+		if err != nil {
+			return err
+		}
+		err = insert(ss[:mid])
+		if err != nil {
+			return err
+		}
+		return insert(ss[mid+1:])
+	}
+	err = insert(ss)
+	if len(orig) > 0 {
+		st.gen.Add(1)
+		st.counts.remaps.Add(1)
+	}
+	if err == nil {
+		st.pending = st.pending[:0]
+	}
+
+	// Report only the symbols that actually changed.
+	m := make(map[symbol]symbol, len(orig))
+	for str, old := range orig {
+		if sym := st.strToSym[str]; sym != old {
+			m[old] = sym
+		}
+	}
+	return m, err
+}
+
+// rebuildKeeping maps all existing and pending strings to symbols from
+// scratch, trying to keep each string's existing symbol.  The function returns
+// a map from old to new symbols for all previously mapped strings whose
+// symbols changed.
+func (st *state) rebuildKeeping() map[symbol]symbol {
+	// Construct a sorted list of unique strings.
+	ss := make([]string, 0, len(st.strToSym)+len(st.pending))
+	for s := range st.strToSym {
+		ss = append(ss, s)
+	}
+	for _, s := range st.pending {
+		if _, ok := st.strToSym[s]; !ok {
+			ss = append(ss, s)
+		}
+	}
+	sort.Strings(ss)
+	n := 0
+	for i, s := range ss {
+		if i == 0 || s != ss[i-1] {
+			ss[n] = s
+			n++
+		}
+	}
+	ss = ss[:n]
+
+	// Build a new tree and new maps based on that tree.
+	oldStrToSym := st.strToSym
+	st.tree = buildKeeping(ss, 1<<63, 0, st.symToStr)
+	st.symToStr = make(map[symbol]string, n)
+	st.strToSym = make(map[string]symbol, n)
+	st.nbytes = 0
+	for _, nd := range st.tree.appendNodes(make([]*tree, 0, n)) {
+		st.symToStr[nd.sym] = nd.str
+		st.strToSym[nd.str] = nd.sym
+		st.nbytes += len(nd.str)
+	}
+	st.pending = st.pending[:0]
+
+	// Report only the symbols that actually changed.
+	m := make(map[symbol]symbol)
+	for s, oldSym := range oldStrToSym {
+		if newSym := st.strToSym[s]; newSym != oldSym {
+			m[oldSym] = newSym
+		}
+	}
+	if len(m) > 0 {
+		st.gen.Add(1)
+		st.counts.remaps.Add(1)
+	}
+	return m
+}
+
+// syntaxError returns a PkgError with code ErrSyntax for a given line of
+// input.
+func syntaxError(line int, str string, format string, a ...any) error {
+	return &PkgError{
+		Code: ErrSyntax,
+		Str:  str,
+		Line: line,
+		msg:  fmt.Sprintf("Line %d: ", line) + fmt.Sprintf(format, a...),
+	}
+}
+
+// A tableEntry is a symbol and its string as read from a textual table.
+type tableEntry struct {
+	sym   symbol   // Symbol
+	str   string   // String associated with sym
+	extra []string // Additional fields
+	line  int      // Line number in the input
+}
+
+// readTable reads a textual table as written by WriteEqs or WriteLGEs.  Each
+// line must contain a symbol, a quoted string, and a given number of
+// additional fields, all separated by tabs.  Blank lines and lines beginning
+// with "#" are ignored.  readTable rejects duplicate symbols and strings.
+func readTable(r io.Reader, ty string, nExtra int) ([]tableEntry, error) {
+	var ents []tableEntry
+	seenSym := make(map[symbol]int)
+	seenStr := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		fs := strings.Split(text, "\t")
+		if len(fs) != nExtra+2 {
+			return nil, syntaxError(line, "", "Expected %d tab-separated fields but saw %d", nExtra+2, len(fs))
+		}
+		v, err := strconv.ParseUint(fs[0], 10, 64)
+		if err != nil || v == 0 {
+			return nil, syntaxError(line, "", "%q is not a valid intern.%s", fs[0], ty)
+		}
+		str, err := strconv.Unquote(fs[1])
+		if err != nil {
+			return nil, syntaxError(line, "", "%s is not a valid quoted string", fs[1])
+		}
+		sym := symbol(v)
+		if prev, ok := seenSym[sym]; ok {
+			return nil, syntaxError(line, str, "%s %d was already defined on line %d", ty, sym, prev)
+		}
+		if prev, ok := seenStr[str]; ok {
+			return nil, syntaxError(line, str, "String %q was already defined on line %d", str, prev)
+		}
+		seenSym[sym] = line
+		seenStr[str] = line
+		ents = append(ents, tableEntry{sym: sym, str: str, extra: fs[2:], line: line})
+	}
+	return ents, scanner.Err()
+}
+
+// assignNext assigns the next available symbol, counting from 1, to a string
+// and returns the new symbol.  Symbols are never reused, even after their
+// strings are forgotten.  If the string already has a symbol associated
+// with it, return the old symbol without allocating a new one.  assignNext
+// returns an error if the string cannot be assigned a symbol.
+func (st *state) assignNext(s, ty string) (symbol, error) {
+	// Check if the string was already assigned a symbol.
+	sym, ok := st.strToSym[s]
+	if ok {
+		st.counts.hits.Add(1)
+		return sym, nil
+	}
+	if st.frozen.Load() != nil {
+		return st.frozenSymbol(s, ty)
+	}
+
+	// We haven't seen this string before.  Find a symbol for it.
+	err := st.admit([]string{s}, ty)
+	st.counts.record(false, err)
+	if err != nil {
+		return 0, err
+	}
+	st.last++
+	sym = st.last
+	st.symToStr[sym] = s
+	st.strToSym[s] = sym
+	st.nbytes += len(s)
+	return sym, nil
 }
 
 // getSymbol looks up and returns the symbol associated with a string.  It
@@ -3,7 +3,13 @@
 
 package intern
 
-import "fmt"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
 
 // An LGE is a string that has been interned to an integer.  An LGE supports
 // less than, greater than, and equal to comparisons (<, <=, >, >=, ==, !=)
@@ -21,41 +27,69 @@ func init() {
 // PreLGE provides advance notice of a string that will be interned using
 // NewLGE.  Batching up a large number of PreLGE calls before calling NewLGE
 // helps avoid running out of symbols that are properly comparable with all
-// other symbols.
+// other symbols.  PreLGE has no effect on a frozen LGE table (see FreezeLGEs)
+// because no new strings can be interned; NewLGE reports an error for those
+// strings instead.
 func PreLGE(s string) {
-	lge.Lock()
-	lge.pending = append(lge.pending, s)
+	lge.lock()
+	if lge.frozen.Load() == nil {
+		lge.pending = append(lge.pending, s)
+	}
 	lge.Unlock()
 }
 
 // PreLGEMulti performs the same operation as PreLGE but accepts a slice of
 // strings instead of an individual string.  This amortizes some costs when
-// pre-allocating a large number of LGEs at once.
+// pre-allocating a large number of LGEs at once.  Like PreLGE, PreLGEMulti
+// has no effect on a frozen LGE table.
 func PreLGEMulti(ss []string) {
-	lge.Lock()
-	lge.pending = append(lge.pending, ss...)
+	lge.lock()
+	if lge.frozen.Load() == nil {
+		lge.pending = append(lge.pending, ss...)
+	}
 	lge.Unlock()
 }
 
 // NewLGE maps a string to an LGE symbol.  It guarantees that two equal strings
 // will always map to the same LGE.  However, it is possible that the package
 // cannot accommodate a particular string, in which case NewLGE returns a
-// non-nil error.  Pre-allocate as many LGEs as possible using PreLGE to reduce
-// the likelihood of that happening.
+// non-nil error that names the string.  Pre-allocate as many LGEs as possible
+// using PreLGE to reduce the likelihood of that happening.  NewLGE does not
+// retain a string it rejects, so later calls are unaffected; pass the string
+// to PreLGE then call RemapSomeLGEs or RemapAllLGEs to make room for it.
+// NewLGE also returns an error if the LGE table has been frozen with
+// FreezeLGEs or if interning the string would exceed the limits set with
+// SetLGELimits.  Strings passed to PreLGE that would exceed those limits or
+// that do not fit are discarded, but the remaining strings are still
+// interned.  NewLGE always succeeds for a string that was previously
+// interned.
 func NewLGE(s string) (LGE, error) {
+	// A frozen table can be read without locking.
+	if lge.frozen.Load() != nil {
+		sym, err := lge.frozenSymbol(s, "LGE")
+		return LGE(sym), err
+	}
+
 	// Acquire a lock on LGE state.
 	var err error
-	lge.Lock()
+	lge.lock()
 	defer lge.Unlock()
+	if lge.frozen.Load() != nil {
+		sym, err := lge.frozenSymbol(s, "LGE")
+		return LGE(sym), err
+	}
 
 	// Mark the new string as pending then flush all pending symbols.
+	_, existed := lge.strToSym[s]
 	lge.pending = append(lge.pending, s)
-	err = lge.flushPending()
+	err = errorFor(lge.flushPending(), s)
 	if err != nil {
+		lge.counts.record(existed, err)
 		return 0, err
 	}
 
 	// Return the new symbol
+	lge.counts.record(existed, nil)
 	return LGE(lge.getSymbol(s)), nil
 }
 
@@ -64,8 +98,7 @@ func NewLGE(s string) (LGE, error) {
 // allocating a large number of LGEs at once.
 func NewLGEMulti(ss []string) ([]LGE, error) {
 	// Acquire a lock on LGE state.
-	var err error
-	lge.Lock()
+	lge.lock()
 	defer lge.Unlock()
 
 	// Mark all new strings as pending then flush all pending symbols.
@@ -73,42 +106,115 @@ func NewLGEMulti(ss []string) ([]LGE, error) {
 	if len(ss) == 0 {
 		return syms, nil
 	}
+	if lge.frozen.Load() != nil {
+		for i, s := range ss {
+			sym, err := lge.frozenSymbol(s, "LGE")
+			if err != nil {
+				return syms, err
+			}
+			syms[i] = LGE(sym)
+		}
+		return syms, nil
+	}
+	nOld := 0
+	for _, s := range ss {
+		if _, ok := lge.strToSym[s]; ok {
+			nOld++
+		}
+	}
 	lge.pending = append(lge.pending, ss...)
-	err = lge.flushPending()
-	if err != nil {
-		return syms, err
+	errs := lge.flushPending()
+	for _, s := range ss {
+		if err := errorFor(errs, s); err != nil {
+			lge.counts.failures.Add(1)
+			return syms, err
+		}
 	}
 
 	// Return the new symbols.
+	lge.counts.hits.Add(uint64(nOld))
+	lge.counts.misses.Add(uint64(len(ss) - nOld))
 	for i, s := range ss {
 		syms[i] = LGE(lge.getSymbol(s))
 	}
 	return syms, nil
 }
 
+// NewLGEBytes is like NewLGE but accepts a slice of bytes.  Like NewLGE, it
+// maps all strings passed to PreLGE to LGEs.  It allocates memory only when
+// it creates a new LGE or there are such pending strings, in which case it
+// copies the bytes to a new string.
+func NewLGEBytes(b []byte) (LGE, error) {
+	if sym, ok := lge.lookupBytes(b); ok && !lge.hasPending() {
+		lge.counts.hits.Add(1)
+		return LGE(sym), nil
+	}
+	return NewLGE(string(b))
+}
+
+// LookupLGE returns the LGE associated with a string without allocating a new
+// LGE.  The second return value is false if the string has not been interned.
+func LookupLGE(s string) (LGE, bool) {
+	sym, ok := lge.lookup(s)
+	return LGE(sym), ok
+}
+
+// LookupLGEBytes is like LookupLGE but accepts a slice of bytes.  It does not
+// allocate memory.
+func LookupLGEBytes(b []byte) (LGE, bool) {
+	sym, ok := lge.lookupBytes(b)
+	return LGE(sym), ok
+}
+
 // String converts an LGE back to a string.  It panics if given an LGE that was
 // not created using NewLGE.
 func (s LGE) String() string {
 	return lge.toString(symbol(s), "LGE")
 }
 
+// SetLGELimits bounds the growth of the LGE table.  Once the limits are
+// reached, NewLGE and related functions return a PkgError with code ErrLimit
+// when given a new string.  Strings that were already interned remain
+// available.  The limits persist across calls to ForgetAllLGEs.
+func SetLGELimits(lim Limits) {
+	lge.lock()
+	lge.limits = lim
+	lge.Unlock()
+}
+
+// Depth returns the depth of an LGE in the tree the package uses to assign
+// LGEs.  The root of the tree lies at depth 0.  NewLGE fails when a string
+// would need to be placed below depth 63, so deep trees are more likely to
+// cause NewLGE to fail.
+func (s LGE) Depth() int {
+	return depthOf(symbol(s))
+}
+
 // ForgetAllLGEs discards all existing mappings from strings to LGEs so the
 // associated memory can be reclaimed.  Use this function only when you know
 // for sure that no previously mapped LGEs will subsequently be used.
 func ForgetAllLGEs() {
-	lge.Lock()
+	lge.lock()
 	lge.forgetAll()
 	lge.Unlock()
 }
 
 // RemapAllLGEs reassigns LGEs to strings to help clean up the mapping.  This
-// provides a way to add strings that were previously rejected by NewLGE.
+// provides a way to add strings that were previously rejected by NewLGE once
+// they are passed to PreLGE.
 // RemapAllLGEs returns a mapping from old LGEs to new LGEs to assist programs
 // with updating LGEs that are in use.
 func RemapAllLGEs() (map[LGE]LGE, error) {
 	// Store the existing LGE state then reinitialize it.
-	lge.Lock()
+	lge.lock()
 	defer lge.Unlock()
+	if lge.frozen.Load() != nil {
+		return nil, frozenError("LGE")
+	}
+	err := firstError(lge.admitPending("LGE"))
+	if err != nil {
+		return nil, err
+	}
 	oldLge := state{
 		pending:  lge.pending,
 		strToSym: lge.strToSym,
@@ -121,11 +227,16 @@ func RemapAllLGEs() (map[LGE]LGE, error) {
 		lge.pending = append(lge.pending, s)
 	}
 
-	// Map all pending strings to LGEs.
-	err := lge.flushPending()
+	// Map all pending strings to LGEs.  The strings have already been
+	// checked against the LGE table's limits.
+	lim := lge.limits
+	lge.limits = Limits{}
+	err = firstError(lge.flushPending())
+	lge.limits = lim
 	if err != nil {
 		return nil, err
 	}
+	lge.counts.remaps.Add(1)
 
 	// Construct a map from old to new LGEs and return it.
 	m := make(map[LGE]LGE, len(lge.strToSym))
@@ -144,33 +255,207 @@ func RemapAllLGEs() (map[LGE]LGE, error) {
 	return m, nil
 }
 
+// RemapAllLGEsMinimal reassigns LGEs to strings, like RemapAllLGEs, but tries
+// to keep existing LGEs.  Working from the root of the tree the package uses
+// to assign LGEs downward, it keeps each string's LGE if the string still fits
+// there and otherwise falls back to a balanced placement.  This greedy
+// approach usually moves few LGEs but does not guarantee moving the fewest
+// possible.  RemapAllLGEsMinimal returns a mapping from old LGEs to new LGEs
+// that includes only those LGEs that changed; hence, len(m) is the number of
+// LGEs that moved.  This reduces the cost of updating LGEs that are in use,
+// especially in large, persisted data structures.
+// Because it rebuilds the entire mapping, RemapAllLGEsMinimal never runs out
+// of LGEs.  It fails only if the LGE table is frozen, in which case it returns
+// a PkgError with code ErrFrozen, or if the strings passed to PreLGE would
+// exceed the limits set with SetLGELimits, in which case it returns a PkgError
+// with code ErrLimit and discards the offending strings.  No LGEs change when
+// RemapAllLGEsMinimal fails.
+func RemapAllLGEsMinimal() (map[LGE]LGE, error) {
+	lge.lock()
+	defer lge.Unlock()
+	if lge.frozen.Load() != nil {
+		return nil, frozenError("LGE")
+	}
+	err := firstError(lge.admitPending("LGE"))
+	if err != nil {
+		return nil, err
+	}
+	sm := lge.rebuildKeeping()
+	m := make(map[LGE]LGE, len(sm))
+	for oldSym, newSym := range sm {
+		m[LGE(oldSym)] = LGE(newSym)
+	}
+	return m, nil
+}
+
+// RemapSomeLGEs assigns LGEs to all strings previously passed to PreLGE,
+// reassigning LGEs to a small number of existing strings as necessary to make
+// room.  Unlike RemapAllLGEs, which reassigns every LGE, RemapSomeLGEs
+// rebuilds only the smallest portion of the mapping that can accommodate each
+// new string.  It returns a mapping from old LGEs to new LGEs that includes
+// only those LGEs that changed.  Programs should call PreLGE on each string
+// rejected by NewLGE then call RemapSomeLGEs to add those strings.  If
+// RemapSomeLGEs fails partway through, it returns the error along with a
+// mapping for the LGEs that had already changed, which programs must still
+// apply to the LGEs they hold.
+func RemapSomeLGEs() (map[LGE]LGE, error) {
+	lge.lock()
+	defer lge.Unlock()
+	if lge.frozen.Load() != nil {
+		return nil, frozenError("LGE")
+	}
+	sm, err := lge.relabelPending()
+	if sm == nil {
+		return nil, err
+	}
+	m := make(map[LGE]LGE, len(sm))
+	for oldSym, newSym := range sm {
+		m[LGE(oldSym)] = LGE(newSym)
+	}
+	return m, err
+}
+
+// WriteLGEs writes all interned LGEs and their associated strings to an
+// io.Writer in increasing order.  Each line contains an LGE as a decimal
+// integer, a tab character, the associated string as a double-quoted Go
+// string literal, another tab character, and the depth of the LGE in the tree
+// the package uses to assign LGEs.  Deep trees are more likely to cause NewLGE
+// to fail.
+func WriteLGEs(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	buf := make([]byte, 0, 64)
+	for sym, str := range AllLGEs() {
+		buf = strconv.AppendUint(buf[:0], uint64(sym), 10)
+		buf = append(buf, '\t')
+		buf = strconv.AppendQuote(buf, str)
+		buf = append(buf, '\t')
+		buf = strconv.AppendInt(buf, int64(sym.Depth()), 10)
+		buf = append(buf, '\n')
+		_, err := bw.Write(buf)
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ReadLGEs replaces all existing LGEs with those read from an io.Reader in
+// the format written by WriteLGEs.  Blank lines and lines beginning with "#"
+// are ignored.  The lines may appear in any order, but the LGEs must respect
+// the order of their strings and must be consistent with the tree the
+// package uses to assign LGEs.  ReadLGEs returns a PkgError with code
+// ErrSyntax that indicates the offending line if the input is malformed or a
+// PkgError with code ErrLimit if the table would exceed the limits set with
+// SetLGELimits.  In either case, the LGE table is left unmodified.  Like
+// ForgetAllLGEs, ReadLGEs invalidates all existing LGEs and unfreezes the LGE
+// table.
+func ReadLGEs(r io.Reader) error {
+	ents, err := readTable(r, "LGE", 1)
+	if err != nil {
+		return err
+	}
+
+	// Ensure that each LGE lies at the specified depth.
+	for _, ent := range ents {
+		d, err := strconv.Atoi(ent.extra[0])
+		if err != nil {
+			return syntaxError(ent.line, ent.str, "%q is not a valid depth", ent.extra[0])
+		}
+		if d != depthOf(ent.sym) {
+			return syntaxError(ent.line, ent.str, "LGE %d lies at depth %d, not %d", ent.sym, depthOf(ent.sym), d)
+		}
+	}
+
+	// Ensure that the LGEs respect the order of their strings.
+	sort.Slice(ents, func(i, j int) bool { return ents[i].sym < ents[j].sym })
+	for i := 1; i < len(ents); i++ {
+		if ents[i].str <= ents[i-1].str {
+			bad, other := ents[i], ents[i-1]
+			if other.line > bad.line {
+				bad, other = other, bad
+			}
+			return syntaxError(bad.line, bad.str,
+				"LGE %d (%q) is out of order with respect to LGE %d (%q) on line %d",
+				bad.sym, bad.str, other.sym, other.str, other.line)
+		}
+	}
+
+	// Reconstruct the tree, parents before children.
+	sort.SliceStable(ents, func(i, j int) bool { return depthOf(ents[i].sym) < depthOf(ents[j].sym) })
+	var t *tree
+	for _, ent := range ents {
+		var sym symbol
+		t, sym, err = t.insert(ent.str)
+		if err != nil || sym != ent.sym {
+			return syntaxError(ent.line, ent.str, "LGE %d has no parent in the tree", ent.sym)
+		}
+	}
+
+	// Replace the LGE table.
+	lge.lock()
+	defer lge.Unlock()
+	err = lge.admitTable(ents, "LGE")
+	if err != nil {
+		return err
+	}
+	lge.forgetAll()
+	lge.tree = t
+	for _, ent := range ents {
+		lge.symToStr[ent.sym] = ent.str
+		lge.strToSym[ent.str] = ent.sym
+		lge.nbytes += len(ent.str)
+	}
+	return nil
+}
+
 // MarshalText converts an LGE to a string and that string to a slice of bytes.
 // With this method, LGE implements the encoding.TextMarshaler interface.
-func (s *LGE) MarshalText() ([]byte, error) {
-	return []byte(lge.toString(symbol(*s), "LGE")), nil
+// MarshalText returns a PkgError with code ErrInvalid if given the zero LGE
+// or any other LGE not associated with a string.
+func (s LGE) MarshalText() ([]byte, error) {
+	return lge.marshal(symbol(s), "LGE")
+}
+
+// newLGESymbol is NewLGE with a symbol return type.
+func newLGESymbol(s string) (symbol, error) {
+	sym, err := NewLGE(s)
+	return symbol(sym), err
 }
 
 // UnmarshalText converts an slice of bytes to a string then interns that
 // string to an LGE.  With this method, LGE implements the
-// encoding.TextUnmarshaler interface.
+// encoding.TextUnmarshaler interface.  See SetLGEUnmarshalStrict for a way to
+// reject strings that have not already been interned.
 func (s *LGE) UnmarshalText(text []byte) error {
-	var err error
-	*s, err = NewLGE(string(text))
+	sym, err := lge.unmarshal(text, "LGE", newLGESymbol)
+	*s = LGE(sym)
 	return err
 }
 
 // MarshalBinary converts an LGE to a string and that string to a slice of
 // bytes.  With this method, LGE implements the encoding.BinaryMarshaler
-// interface.
-func (s *LGE) MarshalBinary() ([]byte, error) {
-	return []byte(lge.toString(symbol(*s), "LGE")), nil
+// interface.  Like MarshalText, MarshalBinary returns a PkgError with code
+// ErrInvalid if given an invalid LGE.
+func (s LGE) MarshalBinary() ([]byte, error) {
+	return lge.marshal(symbol(s), "LGE")
 }
 
 // UnmarshalBinary converts an slice of bytes to a string then interns that
 // string to an LGE.  With this method, LGE implements the
-// encoding.BinaryUnmarshaler interface.
+// encoding.BinaryUnmarshaler interface.  See SetLGEUnmarshalStrict for a way
+// to reject strings that have not already been interned.
 func (s *LGE) UnmarshalBinary(data []byte) error {
-	var err error
-	*s, err = NewLGE(string(data))
+	sym, err := lge.unmarshal(data, "LGE", newLGESymbol)
+	*s = LGE(sym)
 	return err
 }
+
+// SetLGEUnmarshalStrict enables or disables strict unmarshalling of LGEs.  In
+// strict mode, UnmarshalText and UnmarshalBinary never intern new strings.
+// Instead, they return a PkgError with code ErrUnknown when given a string
+// that was not previously interned.  This lets programs that decode data from
+// untrusted sources validate the data against a fixed vocabulary without
+// growing the LGE table.
+func SetLGEUnmarshalStrict(strict bool) {
+	lge.strict.Store(strict)
+}
@@ -104,3 +104,28 @@ func BenchmarkCompareSimilarLGEs(b *testing.B) {
 		}
 	}
 }
+
+// BenchmarkLookupLGEBytes measures the time and memory needed to intern byte
+// slices whose contents were already interned as LGEs.  It should report zero
+// allocations per operation.
+func BenchmarkLookupLGEBytes(b *testing.B) {
+	intern.ForgetAllLGEs()
+	strs := generateRandomStrings(b.N)
+	intern.PreLGEMulti(strs)
+	_, err := intern.NewLGEMulti(strs)
+	if err != nil {
+		b.Fatal(err)
+	}
+	bs := make([][]byte, len(strs))
+	for i, s := range strs {
+		bs[i] = []byte(s)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for _, s := range bs {
+		_, err = intern.NewLGEBytes(s)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"math/rand"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/spakin/intern"
@@ -60,14 +64,58 @@ func TestNewLGEFull(t *testing.T) {
 		}
 	}
 
-	// Creating 65 symbols in alphabetical order should fail.
+	// Re-creating the 64th symbol should still work.
 	str := fmt.Sprintf("This is symbol #%03d.", i)
 	_, err := intern.NewLGE(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating 65 symbols in alphabetical order should fail.
+	str = fmt.Sprintf("This is symbol #%03d.", i+1)
+	_, err = intern.NewLGE(str)
 	if err == nil {
 		t.Fatal("NewLGE failed to return an error when its symbol table filled up")
 	}
 }
 
+// TestNewLGEFullRecovery ensures that a string rejected by NewLGE does not
+// prevent other strings from being interned and that the error names the
+// caller's string.
+func TestNewLGEFullRecovery(t *testing.T) {
+	// Fill the right side of the tree by interning strings in order.
+	intern.ForgetAllLGEs()
+	for i := 0; i < 64; i++ {
+		if _, err := intern.NewLGE(fmt.Sprintf("s%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Queue another string that does not fit, then ensure that a failed
+	// NewLGE reports its own string.
+	intern.PreLGE("s065")
+	for _, str := range []string{"s064", "s066"} {
+		_, err := intern.NewLGE(str)
+		if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrTableFull || e.Str != str {
+			t.Fatalf("Expected an ErrTableFull error for %q but saw %v", str, err)
+		}
+	}
+
+	// Ensure that an unrelated string can still be interned.
+	for _, str := range []string{"a", "b"} {
+		sym, err := intern.NewLGE(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sym.String() != str {
+			t.Fatalf("Expected %q but saw %q", str, sym)
+		}
+	}
+	if _, ok := intern.LookupLGE("s064"); ok {
+		t.Fatal("Expected the rejected string not to be interned")
+	}
+}
+
 // TestLGEOrder ensures that LGE symbol comparisons match the corresponding
 // string comparisons.
 func TestLGEOrder(t *testing.T) {
@@ -272,7 +320,8 @@ func TestLGEConcurrent(t *testing.T) {
 				nc := prng.Intn(20) + 1 // Number of characters
 				_, err := intern.NewLGE(randomString(prng, nc))
 				if err != nil {
-					t.Fatal(err)
+					t.Error(err)
+					break
 				}
 			}
 			done <- true
@@ -367,6 +416,132 @@ func TestRemapAllLGEs(t *testing.T) {
 	}
 }
 
+// TestRemapSomeLGEs tests that only a few LGEs are remapped when a string
+// fails to fit.
+func TestRemapSomeLGEs(t *testing.T) {
+	// Fill the symbol table by allocating symbols in alphabetical order.
+	intern.ForgetAllLGEs()
+	const nStrs = 200
+	strs := make([]string, 0, nStrs)
+	syms := make([]intern.LGE, 0, nStrs)
+	nRemaps := 0
+	for i := 0; i < nStrs; i++ {
+		str := fmt.Sprintf("This is symbol #%03d.", i+1)
+		sym, err := intern.NewLGE(str)
+		if err != nil {
+			// Make room for the new string then update all of
+			// our existing symbols.
+			intern.PreLGE(str)
+			m, err := intern.RemapSomeLGEs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(m) == 0 || len(m) >= len(syms) {
+				t.Fatalf("Expected a few LGEs to be remapped but saw %d of %d", len(m), len(syms))
+			}
+			for j, s := range syms {
+				if n, ok := m[s]; ok {
+					syms[j] = n
+				}
+			}
+			sym, err = intern.NewLGE(str)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nRemaps++
+		}
+		strs = append(strs, str)
+		syms = append(syms, sym)
+	}
+	if nRemaps == 0 {
+		t.Fatal("Expected at least one remap")
+	}
+
+	// Confirm that all LGEs still map to the correct strings and compare
+	// with each other as expected.
+	for i, s := range syms {
+		if s.String() != strs[i] {
+			t.Fatalf("Expected %q but saw %q", strs[i], s)
+		}
+		if i > 0 && syms[i-1] >= s {
+			t.Fatalf("Expected %d < %d for %q < %q", syms[i-1], s, strs[i-1], strs[i])
+		}
+	}
+}
+
+// TestRemapAllLGEsMinimal tests that a minimal-movement remap keeps most
+// existing LGEs unchanged.
+func TestRemapAllLGEsMinimal(t *testing.T) {
+	// Allocate symbols in reverse alphabetical order until we fail.
+	intern.ForgetAllLGEs()
+	strs := make([]string, 0, 100)
+	syms := make([]intern.LGE, 0, 100)
+	var str string
+	for i := 999; ; i-- {
+		str = fmt.Sprintf("This is symbol #%03d.", i)
+		sym, err := intern.NewLGE(str)
+		if err != nil {
+			break
+		}
+		strs = append(strs, str)
+		syms = append(syms, sym)
+	}
+
+	// Remap all LGEs and add the string that failed.
+	intern.PreLGE(str)
+	m, err := intern.RemapAllLGEsMinimal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) == 0 || len(m) >= len(syms)/2 {
+		t.Fatalf("Expected a few LGEs to be remapped but saw %d of %d", len(m), len(syms))
+	}
+	for i, s := range syms {
+		if n, ok := m[s]; ok {
+			syms[i] = n
+		}
+	}
+	sym, err := intern.NewLGE(str)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strs = append(strs, str)
+	syms = append(syms, sym)
+
+	// Confirm that all LGEs still map to the correct strings and compare
+	// with each other as expected.
+	for i, s := range syms {
+		if s.String() != strs[i] {
+			t.Fatalf("Expected %q but saw %q", strs[i], s)
+		}
+		if i > 0 && syms[i-1] <= s {
+			t.Fatalf("Expected %d > %d for %q > %q", syms[i-1], s, strs[i-1], strs[i])
+		}
+	}
+
+	// Ensure that a remap that would exceed the limits changes nothing.
+	intern.SetLGELimits(intern.Limits{MaxSymbols: len(strs)})
+	defer intern.SetLGELimits(intern.Limits{})
+	intern.PreLGE("Another string")
+	_, err = intern.RemapAllLGEsMinimal()
+	checkLimitError(t, err, "Another string")
+	for i, s := range syms {
+		if s.String() != strs[i] {
+			t.Fatalf("Expected %q but saw %q", strs[i], s)
+		}
+	}
+
+	// Ensure that a frozen table cannot be remapped.
+	if err = intern.FreezeLGEs(); err != nil {
+		t.Fatal(err)
+	}
+	defer intern.ForgetAllLGEs()
+	_, err = intern.RemapAllLGEsMinimal()
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrFrozen {
+		t.Fatalf("Expected an ErrFrozen error but saw %v", err)
+	}
+}
+
 // TestLGEMarshalJSON marshals LGEs to JSON and back and checks that the outputs
 // match the input.
 func TestLGEMarshalJSON(t *testing.T) {
@@ -425,6 +600,25 @@ func TestLGEMarshalJSON(t *testing.T) {
 	}
 }
 
+// TestLGEMarshalInvalid tests that marshaling an invalid LGE, such as the zero
+// value, returns an ErrInvalid error instead of panicking.
+func TestLGEMarshalInvalid(t *testing.T) {
+	intern.ForgetAllLGEs()
+	var sym intern.LGE
+	if _, err := sym.MarshalText(); err == nil {
+		t.Fatal("MarshalText failed to reject an invalid LGE")
+	}
+	_, err := sym.MarshalBinary()
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrInvalid {
+		t.Fatalf("Expected an ErrInvalid error but saw %v", err)
+	}
+	_, err = json.Marshal(struct{ S intern.LGE }{})
+	var e *intern.PkgError
+	if !errors.As(err, &e) || e.Code != intern.ErrInvalid {
+		t.Fatalf("Expected an ErrInvalid error but saw %v", err)
+	}
+}
+
 // TestLGEMarshalGob marshals LGEs to a gob and back and checks that the
 // outputs match the input.
 func TestLGEMarshalGob(t *testing.T) {
@@ -486,3 +680,326 @@ func TestLGEMarshalGob(t *testing.T) {
 		})
 	}
 }
+
+// TestLGEBytes tests that we can intern byte slices as LGEs and that doing so
+// does not allocate memory when the string was already interned.
+func TestLGEBytes(t *testing.T) {
+	intern.ForgetAllLGEs()
+	defer intern.ForgetAllLGEs()
+	bs := make([][]byte, len(ozChars))
+	for i, str := range ozChars {
+		bs[i] = []byte(str + " is a character in the Oz series of books")
+		intern.PreLGE(string(bs[i]))
+	}
+	syms := make([]intern.LGE, len(bs))
+	for i, b := range bs {
+		var err error
+		syms[i], err = intern.NewLGEBytes(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if syms[i].String() != string(b) {
+			t.Fatalf("Expected %q but saw %q", b, syms[i])
+		}
+	}
+	if _, ok := intern.LookupLGEBytes([]byte("Not an Oz character")); ok {
+		t.Fatal("Unexpectedly found a string that was never interned")
+	}
+	intern.PreLGE("Pending")
+	if _, err := intern.NewLGEBytes(bs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := intern.LookupLGE("Pending"); !ok {
+		t.Fatal("NewLGEBytes failed to map a pending string to an LGE")
+	}
+	for _, frozen := range []bool{false, true} {
+		if frozen {
+			err := intern.FreezeLGEs()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		allocs := testing.AllocsPerRun(10, func() {
+			for i, b := range bs {
+				if sym, err := intern.NewLGEBytes(b); err != nil || sym != syms[i] {
+					t.Fatalf("Failed to find %q", b)
+				}
+				if sym, ok := intern.LookupLGEBytes(b); !ok || sym != syms[i] {
+					t.Fatalf("Failed to find %q", b)
+				}
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("Expected no allocations (frozen = %v) but saw %.1f", frozen, allocs)
+		}
+	}
+}
+
+// TestLGELimits tests that the LGE table rejects new strings once its limits
+// are reached but continues to accept previously interned strings.
+func TestLGELimits(t *testing.T) {
+	intern.ForgetAllLGEs()
+	defer intern.SetLGELimits(intern.Limits{})
+	defer intern.ForgetAllLGEs()
+	intern.SetLGELimits(intern.Limits{MaxSymbols: 3, MaxBytes: 10, MaxLen: 5})
+	intern.PreLGEMulti([]string{"abc", "defg", "abc"})
+	if _, err := intern.NewLGE("defg"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := intern.NewLGE("tooLong")
+	checkLimitError(t, err, "tooLong")
+	intern.PreLGE("hijk")
+	_, err = intern.NewLGE("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = intern.NewLGEMulti([]string{"hij", "x"})
+	checkLimitError(t, err, "x")
+	if _, err = intern.NewLGE("hij"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = intern.RemapAllLGEs(); err != nil {
+		t.Fatal(err)
+	}
+	if intern.NumLGEs() != 3 {
+		t.Fatalf("Expected 3 LGEs but saw %d", intern.NumLGEs())
+	}
+}
+
+// TestLGELimitsKeepPending tests that strings exceeding the LGE table's
+// limits do not cause other pending strings to be discarded.
+func TestLGELimitsKeepPending(t *testing.T) {
+	intern.ForgetAllLGEs()
+	defer intern.SetLGELimits(intern.Limits{})
+	defer intern.ForgetAllLGEs()
+	intern.SetLGELimits(intern.Limits{MaxLen: 5})
+	intern.PreLGEMulti([]string{"aa", "tooLong", "bb"})
+	if _, err := intern.NewLGE("cc"); err != nil {
+		t.Fatal(err)
+	}
+	intern.PreLGE("alsoTooLong")
+	if _, err := intern.NewLGEMulti([]string{"dd", "ee"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"aa", "bb", "cc", "dd", "ee"} {
+		if _, ok := intern.LookupLGE(s); !ok {
+			t.Fatalf("Failed to intern %q", s)
+		}
+	}
+	if n := intern.NumLGEs(); n != 5 {
+		t.Fatalf("Expected 5 LGEs but saw %d", n)
+	}
+	_, err := intern.NewLGE("tooLong")
+	checkLimitError(t, err, "tooLong")
+}
+
+// TestLGEUnmarshalStrict tests that strict unmarshalling accepts previously
+// interned strings and rejects all others.
+func TestLGEUnmarshalStrict(t *testing.T) {
+	intern.ForgetAllLGEs()
+	intern.PreLGEMulti(ozChars[:10])
+	syms, err := intern.NewLGEMulti(ozChars[:10])
+	if err != nil {
+		t.Fatal(err)
+	}
+	intern.SetLGEUnmarshalStrict(true)
+	defer intern.SetLGEUnmarshalStrict(false)
+	var sym intern.LGE
+	for i, s := range ozChars[:10] {
+		err = sym.UnmarshalBinary([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sym != syms[i] {
+			t.Fatalf("Expected %d but saw %d", syms[i], sym)
+		}
+	}
+	err = sym.UnmarshalText([]byte(ozChars[10]))
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrUnknown || e.Str != ozChars[10] {
+		t.Fatalf("Expected an ErrUnknown error for %q but saw %v", ozChars[10], err)
+	}
+	if n := intern.NumLGEs(); n != 10 {
+		t.Fatalf("Expected 10 LGEs but saw %d", n)
+	}
+}
+
+// lgeRecord is a struct containing LGEs in various forms.
+type lgeRecord struct {
+	Name  intern.LGE   `xml:"name,attr"`
+	Alias intern.LGE   `xml:"alias"`
+	Pair  []intern.LGE `xml:"pair"`
+}
+
+// lgeRecords is a collection of lgeRecords plus a map keyed by LGEs.
+type lgeRecords struct {
+	XMLName xml.Name           `xml:"records" json:"-"`
+	Counts  map[intern.LGE]int `xml:"-"`
+	Recs    []lgeRecord        `xml:"record"`
+}
+
+// checkLGERecords ensures that a lgeRecords contains the expected strings.
+func checkLGERecords(t *testing.T, recs lgeRecords, checkMap bool) {
+	t.Helper()
+	if len(recs.Recs) != len(ozChars) {
+		t.Fatalf("Expected %d records but saw %d", len(ozChars), len(recs.Recs))
+	}
+	for i, s := range ozChars {
+		r := recs.Recs[i]
+		s2 := ozChars[(i+1)%len(ozChars)]
+		if r.Name.String() != s || r.Alias.String() != s2 || len(r.Pair) != 2 || r.Pair[0].String() != s || r.Pair[1].String() != s2 {
+			t.Fatalf("Expected %q and %q but saw %q", s, s2, r)
+		}
+	}
+	if !checkMap {
+		return
+	}
+	if len(recs.Counts) != len(ozChars) {
+		t.Fatalf("Expected %d map entries but saw %d", len(ozChars), len(recs.Counts))
+	}
+	for sym, n := range recs.Counts {
+		if len(sym.String()) != n {
+			t.Fatalf("Expected %q to map to %d but saw %d", sym, len(sym.String()), n)
+		}
+	}
+}
+
+// TestLGEMarshalShapes marshals LGEs that appear as map keys, array
+// elements, and fields of non-pointer structs to JSON and XML and back and
+// checks that the outputs match the input.
+func TestLGEMarshalShapes(t *testing.T) {
+	for r, rStr := range []string{
+		"NoForget",
+		"Forget",
+	} {
+		t.Run(rStr, func(t *testing.T) {
+			// Create a collection of records.
+			intern.ForgetAllLGEs()
+			intern.PreLGEMulti(ozChars)
+			syms, err := intern.NewLGEMulti(ozChars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			in := lgeRecords{Counts: make(map[intern.LGE]int, len(syms))}
+			for i, sym := range syms {
+				sym2 := syms[(i+1)%len(syms)]
+				in.Counts[sym] = len(ozChars[i])
+				in.Recs = append(in.Recs, lgeRecord{
+					Name:  sym,
+					Alias: sym2,
+					Pair:  []intern.LGE{sym, sym2},
+				})
+			}
+
+			// Encode the records as JSON and as XML.  Pass the
+			// records by value so no LGE is addressable.
+			jb, err := json.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			xb, err := xml.Marshal(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(jb, []byte(strconv.Quote(ozChars[0])+":")) {
+				t.Fatalf("Expected %q to be encoded as a JSON map key", ozChars[0])
+			}
+
+			// On our second iteration, forget our entire mapping.
+			if r == 1 {
+				intern.ForgetAllLGEs()
+				intern.PreLGEMulti(ozChars)
+			}
+
+			// Decode the records and ensure that they match the
+			// original strings.
+			var jOut, xOut lgeRecords
+			err = json.Unmarshal(jb, &jOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLGERecords(t, jOut, true)
+			err = xml.Unmarshal(xb, &xOut)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkLGERecords(t, xOut, false)
+		})
+	}
+}
+
+// TestReadLGEs tests that we can import LGEs exported by WriteLGEs and that we
+// reject malformed input.
+func TestReadLGEs(t *testing.T) {
+	intern.ForgetAllLGEs()
+	syms := make([]intern.LGE, len(ozChars))
+	for i, s := range ozChars {
+		var err error
+		syms[i], err = intern.NewLGE(s)
+		if err != nil {
+			intern.PreLGE(s)
+			if _, err = intern.RemapAllLGEs(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var sb strings.Builder
+	err := intern.WriteLGEs(&sb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := make(map[string]intern.LGE, len(ozChars))
+	for sym, s := range intern.AllLGEs() {
+		exp[s] = sym
+	}
+
+	// Read the LGEs back in reverse order.
+	lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	intern.ForgetAllLGEs()
+	err = intern.ReadLGEs(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for s, sym := range exp {
+		if got, ok := intern.LookupLGE(s); !ok || got != sym {
+			t.Fatalf("Expected %q to map to %d but saw %d", s, sym, got)
+		}
+	}
+
+	// Ensure that the reconstructed tree accepts new strings.
+	if _, err = intern.NewLGE("Not an Oz character"); err != nil {
+		intern.PreLGE("Not an Oz character")
+		if _, err = intern.RemapSomeLGEs(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Ensure that malformed input is rejected.
+	for _, c := range []struct {
+		text string
+		line int
+	}{
+		{"9223372036854775808\t\"m\"\t0\n4611686018427387904\t\"z\"\t1\n", 2},
+		{"9223372036854775808\t\"m\"\t0\n4611686018427387904\t\"a\"\t2\n", 2},
+		{"9223372036854775808\t\"m\"\t0\n2305843009213693952\t\"a\"\t2\n", 2},
+		{"9223372036854775808\t\"m\"\n", 1},
+		{"9223372036854775808\t\"m\\q\"\t0\n", 1},
+	} {
+		checkSyntaxError(t, intern.ReadLGEs(strings.NewReader(c.text)), c.line)
+	}
+
+	// Ensure that tables exceeding the limits are rejected.
+	n := intern.NumLGEs()
+	intern.SetLGELimits(intern.Limits{MaxSymbols: 1})
+	defer intern.SetLGELimits(intern.Limits{})
+	err = intern.ReadLGEs(strings.NewReader("9223372036854775808\t\"m\"\t0\n4611686018427387904\t\"a\"\t1\n"))
+	checkLimitError(t, err, "a")
+	if e := err.(*intern.PkgError); e.Line != 2 {
+		t.Fatalf("Expected line 2 but saw line %d", e.Line)
+	}
+	if intern.NumLGEs() != n {
+		t.Fatal("An oversized table modified the LGE table")
+	}
+}
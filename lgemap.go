@@ -0,0 +1,412 @@
+// This file provides ordered containers that compare their contents by LGE.
+
+package intern
+
+import (
+	"container/heap"
+	"iter"
+	"sort"
+	"strings"
+)
+
+// internLGEs maps a list of strings to LGEs.  It returns the LGEs and the
+// generation number of the LGE table at the time the LGEs were assigned.
+// internLGEs never reassigns existing LGEs; if the LGE table has no room for
+// a string, it returns a PkgError with code ErrTableFull.
+func internLGEs(ss []string) ([]LGE, uint64, error) {
+	lge.lock()
+	defer lge.Unlock()
+	syms := make([]LGE, len(ss))
+	if lge.frozen.Load() != nil {
+		for i, s := range ss {
+			sym, err := lge.frozenSymbol(s, "LGE")
+			if err != nil {
+				return nil, 0, err
+			}
+			syms[i] = LGE(sym)
+		}
+		return syms, lge.gen.Load(), nil
+	}
+	lge.pending = append(lge.pending, ss...)
+	errs := lge.flushPending()
+	for i, s := range ss {
+		if err := errorFor(errs, s); err != nil {
+			return nil, 0, err
+		}
+		syms[i] = LGE(lge.getSymbol(s))
+	}
+	return syms, lge.gen.Load(), nil
+}
+
+// An lgeList is a list of strings and their LGEs.  It re-interns its strings
+// whenever the LGE table has been remapped or forgotten since the LGEs were
+// last assigned.
+type lgeList struct {
+	strs  []string // Strings in the list
+	syms  []LGE    // LGE corresponding to each string
+	gen   uint64   // LGE table generation to which syms corresponds
+	stale bool     // true if syms could not be brought up to date
+}
+
+// refresh brings a list's LGEs up to date with the LGE table.  If this fails,
+// the list is marked stale, and comparisons fall back to strings.
+func (l *lgeList) refresh() {
+	l.stale = false
+	gen := lge.gen.Load()
+	if len(l.strs) == 0 {
+		l.gen = gen
+	}
+	if l.gen == gen {
+		return
+	}
+	syms, gen, err := internLGEs(l.strs)
+	if err != nil {
+		l.stale = true
+		return
+	}
+	l.syms, l.gen = syms, gen
+}
+
+// less says if the string at one index precedes the string at another.
+func (l *lgeList) less(i, j int) bool {
+	if l.stale {
+		return l.strs[i] < l.strs[j]
+	}
+	return l.syms[i] < l.syms[j]
+}
+
+// swap swaps the strings and LGEs at two indexes.
+func (l *lgeList) swap(i, j int) {
+	l.strs[i], l.strs[j] = l.strs[j], l.strs[i]
+	l.syms[i], l.syms[j] = l.syms[j], l.syms[i]
+}
+
+// insertAt inserts a string and its LGE at a given index.
+func (l *lgeList) insertAt(i int, s string, sym LGE) {
+	l.strs = append(l.strs, "")
+	copy(l.strs[i+1:], l.strs[i:])
+	l.strs[i] = s
+	l.syms = append(l.syms, 0)
+	copy(l.syms[i+1:], l.syms[i:])
+	l.syms[i] = sym
+}
+
+// deleteAt removes the string and LGE at a given index.
+func (l *lgeList) deleteAt(i int) {
+	l.strs = append(l.strs[:i], l.strs[i+1:]...)
+	l.syms = append(l.syms[:i], l.syms[i+1:]...)
+}
+
+// add interns a string and appends it to a list.  If interning the string
+// reassigns any LGEs, the list's other LGEs are refreshed as well.
+func (l *lgeList) add(s string) error {
+	syms, gen, err := internLGEs([]string{s})
+	if err != nil {
+		return err
+	}
+	l.strs = append(l.strs, s)
+	l.syms = append(l.syms, syms[0])
+	if gen != l.gen {
+		l.gen = 0 // Generation numbers start at 1.
+		l.refresh()
+	}
+	return nil
+}
+
+// search returns the index of the first string in a sorted list that is at
+// least a given string.
+func (l *lgeList) search(s string) int {
+	for {
+		l.refresh()
+		if l.stale {
+			return sort.SearchStrings(l.strs, s)
+		}
+		lge.RLock()
+		if lge.gen.Load() != l.gen {
+			lge.RUnlock()
+			continue
+		}
+		t := lge.tree.ceiling(s)
+		lge.RUnlock()
+		if t == nil {
+			return len(l.syms)
+		}
+		c := LGE(t.sym)
+		return sort.Search(len(l.syms), func(i int) bool { return l.syms[i] >= c })
+	}
+}
+
+// find returns the index of a string in a sorted list.  The second return
+// value is false if the string is not present.
+func (l *lgeList) find(s string) (int, bool) {
+	i := l.search(s)
+	return i, i < len(l.strs) && l.strs[i] == s
+}
+
+// insert adds a string to a sorted list if not already present.  It returns
+// the string's index and true if the string was added.
+func (l *lgeList) insert(s string) (int, bool, error) {
+	i, ok := l.find(s)
+	if ok {
+		return i, false, nil
+	}
+	syms, gen, err := internLGEs([]string{s})
+	if err != nil {
+		return 0, false, err
+	}
+	l.insertAt(i, s, syms[0])
+	if gen != l.gen {
+		l.gen = 0 // Generation numbers start at 1.
+		l.refresh()
+	}
+	return i, true, nil
+}
+
+// bounds returns the indexes delimiting all strings in a sorted list that are
+// at least lo and less than hi.
+func (l *lgeList) bounds(lo, hi string) (int, int) {
+	i := l.search(lo)
+	if hi <= lo {
+		return i, i
+	}
+	return i, l.search(hi)
+}
+
+// prefixBounds returns the indexes delimiting all strings in a sorted list
+// that begin with a given prefix.
+func (l *lgeList) prefixBounds(prefix string) (int, int) {
+	i := l.search(prefix)
+	j := i
+	for j < len(l.strs) && strings.HasPrefix(l.strs[j], prefix) {
+		j++
+	}
+	return i, j
+}
+
+// seq returns an iterator over a range of a list's LGEs and strings.
+func (l *lgeList) seq(i, j int) iter.Seq2[LGE, string] {
+	return func(yield func(LGE, string) bool) {
+		for k := i; k < j && k < len(l.strs); k++ {
+			if !yield(l.syms[k], l.strs[k]) {
+				return
+			}
+		}
+	}
+}
+
+// An LGESortedSet is a set of strings that is kept sorted by LGE.  Strings
+// are interned as they are added, and the set re-interns its contents
+// automatically if the LGE table is remapped (e.g., by RemapAllLGEs) or
+// forgotten.  An LGESortedSet never remaps the LGE table itself because that
+// would change LGEs the program holds elsewhere.  Hence, if the LGE table has
+// no room for a new string, Add returns a PkgError with code ErrTableFull,
+// and the program can pass the string to PreLGE, call RemapSomeLGEs, apply
+// the resulting map to its own LGEs, and try again.  The zero value is an
+// empty set ready to use.  An LGESortedSet is not safe for concurrent use.
+type LGESortedSet struct {
+	l lgeList
+}
+
+// Add adds a string to a set.  It returns an error only if the string cannot
+// be interned, which can happen if the LGE table is frozen, has reached its
+// limits, or has no room for the string.
+func (s *LGESortedSet) Add(str string) error {
+	_, _, err := s.l.insert(str)
+	return err
+}
+
+// Remove removes a string from a set.  It returns false if the string was not
+// present.
+func (s *LGESortedSet) Remove(str string) bool {
+	i, ok := s.l.find(str)
+	if ok {
+		s.l.deleteAt(i)
+	}
+	return ok
+}
+
+// Contains reports whether a set contains a given string.
+func (s *LGESortedSet) Contains(str string) bool {
+	_, ok := s.l.find(str)
+	return ok
+}
+
+// Len returns the number of strings in a set.
+func (s *LGESortedSet) Len() int {
+	return len(s.l.strs)
+}
+
+// All returns an iterator over all strings in a set and their LGEs in
+// increasing order.  The set must not be modified during iteration.
+func (s *LGESortedSet) All() iter.Seq2[LGE, string] {
+	s.l.refresh()
+	return s.l.seq(0, len(s.l.strs))
+}
+
+// Range returns an iterator over all strings in a set that are at least lo
+// and less than hi, and their LGEs, in increasing order.
+func (s *LGESortedSet) Range(lo, hi string) iter.Seq2[LGE, string] {
+	return s.l.seq(s.l.bounds(lo, hi))
+}
+
+// Prefix returns an iterator over all strings in a set that begin with a
+// given prefix, and their LGEs, in increasing order.
+func (s *LGESortedSet) Prefix(prefix string) iter.Seq2[LGE, string] {
+	return s.l.seq(s.l.prefixBounds(prefix))
+}
+
+// An LGESortedMap maps strings to values of an arbitrary type and keeps its
+// keys sorted by LGE.  Like an LGESortedSet, an LGESortedMap interns its keys
+// as they are added and re-interns them automatically whenever the LGE table
+// is remapped or forgotten.  The zero value is an empty map ready to use.  An
+// LGESortedMap is not safe for concurrent use.
+type LGESortedMap[V any] struct {
+	l    lgeList
+	vals []V // Value associated with each key
+}
+
+// Get returns the value associated with a string.  The second return value
+// is false if the string is not present in the map.
+func (m *LGESortedMap[V]) Get(str string) (V, bool) {
+	i, ok := m.l.find(str)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return m.vals[i], true
+}
+
+// Set associates a value with a string.  It returns an error only if the
+// string cannot be interned, which can happen if the LGE table is frozen, has
+// reached its limits, or has no room for the string.
+func (m *LGESortedMap[V]) Set(str string, v V) error {
+	i, added, err := m.l.insert(str)
+	if err != nil {
+		return err
+	}
+	if added {
+		var zero V
+		m.vals = append(m.vals, zero)
+		copy(m.vals[i+1:], m.vals[i:])
+	}
+	m.vals[i] = v
+	return nil
+}
+
+// Delete removes a string and its associated value from a map.  It returns
+// false if the string was not present.
+func (m *LGESortedMap[V]) Delete(str string) bool {
+	i, ok := m.l.find(str)
+	if ok {
+		m.l.deleteAt(i)
+		m.vals = append(m.vals[:i], m.vals[i+1:]...)
+	}
+	return ok
+}
+
+// Len returns the number of strings in a map.
+func (m *LGESortedMap[V]) Len() int {
+	return len(m.l.strs)
+}
+
+// seq returns an iterator over a range of a map's keys and values.
+func (m *LGESortedMap[V]) seq(i, j int) iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		for k := i; k < j && k < len(m.vals); k++ {
+			if !yield(m.l.strs[k], m.vals[k]) {
+				return
+			}
+		}
+	}
+}
+
+// All returns an iterator over all strings in a map and their associated
+// values in increasing order of string.  The map must not be modified during
+// iteration.
+func (m *LGESortedMap[V]) All() iter.Seq2[string, V] {
+	return m.seq(0, len(m.vals))
+}
+
+// Range returns an iterator over all strings in a map that are at least lo
+// and less than hi, and their associated values, in increasing order.
+func (m *LGESortedMap[V]) Range(lo, hi string) iter.Seq2[string, V] {
+	return m.seq(m.l.bounds(lo, hi))
+}
+
+// Prefix returns an iterator over all strings in a map that begin with a given
+// prefix, and their associated values, in increasing order.
+func (m *LGESortedMap[V]) Prefix(prefix string) iter.Seq2[string, V] {
+	return m.seq(m.l.prefixBounds(prefix))
+}
+
+// lgeHeap adapts an lgeList to heap.Interface.
+type lgeHeap struct {
+	l lgeList
+}
+
+// Len returns the length of an lgeHeap.
+func (h *lgeHeap) Len() int { return len(h.l.strs) }
+
+// Less says if one lgeHeap element precedes another.
+func (h *lgeHeap) Less(i, j int) bool { return h.l.less(i, j) }
+
+// Swap swaps two elements of an lgeHeap.
+func (h *lgeHeap) Swap(i, j int) { h.l.swap(i, j) }
+
+// Push is a no-op because LGEQueue appends to the list itself.
+func (h *lgeHeap) Push(x any) {}
+
+// Pop removes the final element of an lgeHeap.
+func (h *lgeHeap) Pop() any {
+	h.l.deleteAt(len(h.l.strs) - 1)
+	return nil
+}
+
+// An LGEQueue is a priority queue of strings ordered by LGE.  It replaces the
+// hand-written SymQ type shown in the package's examples: strings are
+// interned as they are pushed, and the queue re-interns its contents
+// automatically whenever the LGE table is remapped or forgotten.  Because
+// remapping preserves the relative order of all LGEs, this never disturbs the
+// queue's ordering.  The zero value is an empty queue ready to use.  An
+// LGEQueue is not safe for concurrent use.
+type LGEQueue struct {
+	h lgeHeap
+}
+
+// Push interns a string and adds it to a queue.  It returns an error only if
+// the string cannot be interned, which can happen if the LGE table is frozen,
+// has reached its limits, or has no room for the string.
+func (q *LGEQueue) Push(str string) error {
+	err := q.h.l.add(str)
+	if err != nil {
+		return err
+	}
+	heap.Push(&q.h, nil)
+	return nil
+}
+
+// Pop removes and returns the least string in a queue.  The second return
+// value is false if the queue is empty.
+func (q *LGEQueue) Pop() (string, bool) {
+	if len(q.h.l.strs) == 0 {
+		return "", false
+	}
+	q.h.l.refresh()
+	str := q.h.l.strs[0]
+	heap.Pop(&q.h)
+	return str, true
+}
+
+// Peek returns the least string in a queue without removing it.  The second
+// return value is false if the queue is empty.
+func (q *LGEQueue) Peek() (string, bool) {
+	if len(q.h.l.strs) == 0 {
+		return "", false
+	}
+	return q.h.l.strs[0], true
+}
+
+// Len returns the number of strings in a queue.
+func (q *LGEQueue) Len() int {
+	return len(q.h.l.strs)
+}
@@ -0,0 +1,215 @@
+// This file provides unit tests for ordered containers keyed by LGEs.
+
+package intern_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// reverseSortedOzChars returns a reverse-sorted copy of ozChars.  Interning
+// strings in this order is a worst case for LGEs.
+func reverseSortedOzChars() []string {
+	strs := sortedOzChars()
+	for i, j := 0, len(strs)-1; i < j; i, j = i+1, j-1 {
+		strs[i], strs[j] = strs[j], strs[i]
+	}
+	return strs
+}
+
+// checkLGESortedSet ensures that iterating over an LGESortedSet yields
+// exactly a given list of strings with correctly ordered LGEs.
+func checkLGESortedSet(t *testing.T, seq func(func(intern.LGE, string) bool), exp []string) {
+	t.Helper()
+	var syms []intern.LGE
+	var strs []string
+	for sym, str := range seq {
+		syms = append(syms, sym)
+		strs = append(strs, str)
+	}
+	checkLGEs(t, syms, strs, exp)
+}
+
+// addWithRoom calls a function that interns a string.  If the LGE table has
+// no room for the string, addWithRoom makes room with RemapSomeLGEs and calls
+// the function again.
+func addWithRoom(t *testing.T, str string, add func(string) error) {
+	t.Helper()
+	err := add(str)
+	if e, ok := err.(*intern.PkgError); ok && e.Code == intern.ErrTableFull {
+		intern.PreLGE(str)
+		if _, err = intern.RemapSomeLGEs(); err != nil {
+			t.Fatal(err)
+		}
+		err = add(str)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLGESortedSet tests that an LGESortedSet maintains order even when
+// strings are added in worst-case order and the LGE table is remapped.
+func TestLGESortedSet(t *testing.T) {
+	intern.ForgetAllLGEs()
+	var s intern.LGESortedSet
+	for _, str := range reverseSortedOzChars() {
+		addWithRoom(t, str, s.Add)
+	}
+	err := s.Add(ozChars[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := sortedOzChars()
+	checkLGESortedSet(t, s.All(), exp)
+
+	// Ensure the set survives remapping and forgetting all LGEs.
+	if _, err := intern.RemapAllLGEs(); err != nil {
+		t.Fatal(err)
+	}
+	checkLGESortedSet(t, s.All(), exp)
+	intern.ForgetAllLGEs()
+	if !s.Contains(ozChars[1]) {
+		t.Fatalf("Expected the set to contain %q", ozChars[1])
+	}
+	checkLGESortedSet(t, s.All(), exp)
+
+	// Test range and prefix queries.
+	var rExp, pExp []string
+	for _, str := range exp {
+		if str >= "Glinda" && str < "Jester" {
+			rExp = append(rExp, str)
+		}
+		if strings.HasPrefix(str, "King") {
+			pExp = append(pExp, str)
+		}
+	}
+	checkLGESortedSet(t, s.Range("Glinda", "Jester"), rExp)
+	checkLGESortedSet(t, s.Prefix("King"), pExp)
+
+	// Test removal.
+	for _, str := range pExp {
+		if !s.Remove(str) {
+			t.Fatalf("Failed to remove %q", str)
+		}
+		if s.Remove(str) {
+			t.Fatalf("Removed %q twice", str)
+		}
+	}
+	if s.Len() != len(exp)-len(pExp) {
+		t.Fatalf("Expected %d strings but saw %d", len(exp)-len(pExp), s.Len())
+	}
+	checkLGESortedSet(t, s.Prefix("King"), nil)
+}
+
+// TestLGESortedMap tests basic LGESortedMap operations.
+func TestLGESortedMap(t *testing.T) {
+	intern.ForgetAllLGEs()
+	var m intern.LGESortedMap[int]
+	for _, str := range reverseSortedOzChars() {
+		addWithRoom(t, str, func(str string) error { return m.Set(str, len(str)) })
+	}
+	intern.ForgetAllLGEs()
+	for _, str := range ozChars {
+		v, ok := m.Get(str)
+		if !ok || v != len(str) {
+			t.Fatalf("Expected %q to map to %d but saw %d", str, len(str), v)
+		}
+	}
+	if !m.Delete(ozChars[0]) || m.Delete(ozChars[0]) {
+		t.Fatalf("Failed to delete %q exactly once", ozChars[0])
+	}
+	if _, ok := m.Get(ozChars[0]); ok {
+		t.Fatalf("Failed to delete %q", ozChars[0])
+	}
+	prev := ""
+	n := 0
+	for str, v := range m.All() {
+		if str <= prev {
+			t.Fatalf("Strings %q and %q are out of order", prev, str)
+		}
+		if v != len(str) {
+			t.Fatalf("Expected %q to map to %d but saw %d", str, len(str), v)
+		}
+		prev = str
+		n++
+	}
+	if n != len(ozChars)-1 || m.Len() != n {
+		t.Fatalf("Expected %d strings but saw %d", len(ozChars)-1, n)
+	}
+	for str := range m.Prefix("King") {
+		if !strings.HasPrefix(str, "King") {
+			t.Fatalf("Unexpected string %q in prefix query", str)
+		}
+	}
+}
+
+// TestLGEQueue tests that an LGEQueue returns strings in sorted order even
+// when pushed in worst-case order.
+func TestLGEQueue(t *testing.T) {
+	intern.ForgetAllLGEs()
+	var q intern.LGEQueue
+	for _, str := range reverseSortedOzChars() {
+		addWithRoom(t, str, q.Push)
+	}
+	if _, err := intern.RemapAllLGEs(); err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range sortedOzChars() {
+		if i == len(ozChars)/2 {
+			intern.ForgetAllLGEs()
+		}
+		if str, ok := q.Peek(); !ok || str != exp {
+			t.Fatalf("Expected to peek at %q but saw %q", exp, str)
+		}
+		if str, ok := q.Pop(); !ok || str != exp {
+			t.Fatalf("Expected to pop %q but saw %q", exp, str)
+		}
+	}
+	if _, ok := q.Pop(); ok || q.Len() != 0 {
+		t.Fatal("Expected the queue to be empty")
+	}
+}
+
+// TestLGEContainersFull ensures that the LGE containers report a full LGE
+// table instead of reassigning LGEs the program holds elsewhere.
+func TestLGEContainersFull(t *testing.T) {
+	// Fill the LGE table by interning strings in order.
+	intern.ForgetAllLGEs()
+	syms := make(map[intern.LGE]string, 64)
+	for i := 0; i < 64; i++ {
+		str := fmt.Sprintf("s%03d", i)
+		sym, err := intern.NewLGE(str)
+		if err != nil {
+			t.Fatal(err)
+		}
+		syms[sym] = str
+	}
+
+	// Ensure that each container rejects a new string and leaves all
+	// existing LGEs alone.
+	var s intern.LGESortedSet
+	var m intern.LGESortedMap[int]
+	var q intern.LGEQueue
+	for _, add := range []func(string) error{
+		s.Add,
+		func(str string) error { return m.Set(str, 0) },
+		q.Push,
+	} {
+		err := add("s064")
+		if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrTableFull {
+			t.Fatalf("Expected an ErrTableFull error but saw %v", err)
+		}
+		for sym, str := range syms {
+			if got, ok := intern.LookupLGE(str); !ok || got != sym {
+				t.Fatalf("Expected %q to remain %d but saw %d", str, sym, got)
+			}
+		}
+	}
+	if s.Len() != 0 || m.Len() != 0 || q.Len() != 0 {
+		t.Fatal("Expected all containers to be empty")
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Package metrics publishes the intern package's symbol-table statistics.
+
+Importing this package publishes the statistics through the expvar package
+under the name "intern", as a JSON object with one member per table ("Eq"
+and "LGE").  As with expvar itself, this makes the statistics available at
+/debug/vars on http.DefaultServeMux.  The package additionally provides an
+http.Handler that serves the statistics in the Prometheus text exposition
+format:
+
+	http.Handle("/metrics", metrics.Handler())
+
+The metrics package is separate from the intern package so that programs
+that do not want their symbol tables published are unaffected by expvar's
+side effects.
+*/
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/spakin/intern"
+)
+
+// init publishes the statistics through expvar.
+func init() {
+	expvar.Publish("intern", expvar.Func(func() any {
+		return map[string]intern.Stats{
+			"Eq":  intern.EqStats(),
+			"LGE": intern.LGEStats(),
+		}
+	}))
+}
+
+// A metric describes one statistic as Prometheus presents it.
+type metric struct {
+	name string                 // Metric name
+	kind string                 // Prometheus metric type
+	help string                 // Description of the metric
+	get  func(intern.Stats) any // Value of the metric
+}
+
+// metrics lists all metrics in the order in which they are written.
+var metrics = []metric{
+	{"intern_symbols", "gauge", "Number of interned strings.",
+		func(s intern.Stats) any { return s.Symbols }},
+	{"intern_bytes", "gauge", "Total length in bytes of all interned strings.",
+		func(s intern.Stats) any { return s.Bytes }},
+	{"intern_pending", "gauge", "Number of strings awaiting interning.",
+		func(s intern.Stats) any { return s.Pending }},
+	{"intern_frozen", "gauge", "1 if the table is frozen, 0 otherwise.",
+		func(s intern.Stats) any {
+			if s.Frozen {
+				return 1
+			}
+			return 0
+		}},
+	{"intern_hits_total", "counter", "Requests to intern an already interned string.",
+		func(s intern.Stats) any { return s.Hits }},
+	{"intern_misses_total", "counter", "Requests that interned a new string.",
+		func(s intern.Stats) any { return s.Misses }},
+	{"intern_failures_total", "counter", "Requests that failed to intern a string.",
+		func(s intern.Stats) any { return s.Failures }},
+	{"intern_remaps_total", "counter", "Number of times existing symbols were reassigned.",
+		func(s intern.Stats) any { return s.Remaps }},
+	{"intern_lock_wait_seconds_total", "counter", "Total time spent waiting to modify the table.",
+		func(s intern.Stats) any { return s.LockWait.Seconds() }},
+}
+
+// WritePrometheus writes the statistics for both symbol tables to an
+// io.Writer in the Prometheus text exposition format.  Each metric carries a
+// "table" label whose value is either "eq" or "lge".
+func WritePrometheus(w io.Writer) error {
+	tables := []struct {
+		name  string
+		stats intern.Stats
+	}{
+		{"eq", intern.EqStats()},
+		{"lge", intern.LGEStats()},
+	}
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.kind)
+		for _, t := range tables {
+			fmt.Fprintf(bw, "%s{table=%q} %v\n", m.name, t.name, m.get(t.stats))
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler that serves the statistics for both symbol
+// tables in the Prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w) // Fails only if the client went away.
+	})
+}
@@ -0,0 +1,67 @@
+// This file provides unit tests for the metrics package.
+
+package metrics_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spakin/intern"
+	"github.com/spakin/intern/metrics"
+)
+
+// TestExpvar ensures that the statistics are published through expvar.
+func TestExpvar(t *testing.T) {
+	intern.ForgetAllEqs()
+	intern.NewEqMulti([]string{"alpha", "beta"})
+	v := expvar.Get("intern")
+	if v == nil {
+		t.Fatal("No intern variable was published")
+	}
+	var stats map[string]intern.Stats
+	err := json.Unmarshal([]byte(v.String()), &stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := stats["Eq"]; s.Symbols != 2 || s.Bytes != 9 {
+		t.Fatalf("Unexpected Eq statistics %+v", s)
+	}
+	if _, ok := stats["LGE"]; !ok {
+		t.Fatal("No LGE statistics were published")
+	}
+}
+
+// TestHandler ensures that the Prometheus handler serves every metric for
+// both tables.
+func TestHandler(t *testing.T) {
+	intern.ForgetAllEqs()
+	intern.ForgetAllLGEs()
+	intern.NewEqMulti([]string{"alpha", "beta", "gamma"})
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Fatalf("Unexpected content type %q", ct)
+	}
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(body)
+	for _, ln := range []string{
+		"# TYPE intern_symbols gauge\n",
+		"intern_symbols{table=\"eq\"} 3\n",
+		"intern_symbols{table=\"lge\"} 0\n",
+		"intern_bytes{table=\"eq\"} 14\n",
+		"# TYPE intern_misses_total counter\n",
+		"intern_frozen{table=\"lge\"} 0\n",
+		"# TYPE intern_lock_wait_seconds_total counter\n",
+	} {
+		if !strings.Contains(out, ln) {
+			t.Fatalf("Expected %q in\n%s", ln, out)
+		}
+	}
+}
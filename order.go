@@ -0,0 +1,239 @@
+// This file provides ordered queries over the strings that have been interned
+// as LGEs.
+
+package intern
+
+import (
+	"fmt"
+	"iter"
+	"sort"
+	"strings"
+)
+
+// lgePair associates an LGE with its string.
+type lgePair struct {
+	sym LGE    // Interned string
+	str string // Original string
+}
+
+// collectLGEs returns, in order, each LGE whose string is at least lo,
+// stopping at the first string for which in returns false.
+func collectLGEs(lo string, in func(string) bool) []lgePair {
+	lge.RLock()
+	defer lge.RUnlock()
+	var ps []lgePair
+	lge.tree.ascend(lo, func(t *tree) bool {
+		if !in(t.str) {
+			return false
+		}
+		ps = append(ps, lgePair{sym: LGE(t.sym), str: t.str})
+		return true
+	})
+	return ps
+}
+
+// seqLGEs returns an iterator over the LGEs that collectLGEs returns.  The
+// LGEs are collected anew each time the iterator is used.  The LGE state is
+// not locked while the caller consumes them.
+func seqLGEs(lo string, in func(string) bool) iter.Seq2[LGE, string] {
+	return func(yield func(LGE, string) bool) {
+		for _, p := range collectLGEs(lo, in) {
+			if !yield(p.sym, p.str) {
+				return
+			}
+		}
+	}
+}
+
+// AllLGEs returns an iterator over all interned LGEs and their associated
+// strings in increasing order.  Strings passed to PreLGE but not yet passed
+// to NewLGE are not included.  The iterator reflects the LGEs that exist when
+// iteration begins, and the loop body may safely call other functions in this
+// package.
+func AllLGEs() iter.Seq2[LGE, string] {
+	return seqLGEs("", func(string) bool { return true })
+}
+
+// RangeLGEs returns an iterator over all interned LGEs whose associated
+// strings are at least lo and less than hi, in increasing order.
+func RangeLGEs(lo, hi string) iter.Seq2[LGE, string] {
+	return seqLGEs(lo, func(s string) bool { return s < hi })
+}
+
+// PrefixLGEs returns an iterator over all interned LGEs whose associated
+// strings begin with a given prefix, in increasing order.
+func PrefixLGEs(prefix string) iter.Seq2[LGE, string] {
+	return seqLGEs(prefix, func(s string) bool { return strings.HasPrefix(s, prefix) })
+}
+
+// WalkLGEs calls a function on each interned LGE and its associated string in
+// increasing order until the function returns false.
+func WalkLGEs(f func(LGE, string) bool) {
+	for sym, str := range AllLGEs() {
+		if !f(sym, str) {
+			return
+		}
+	}
+}
+
+// WalkRangeLGEs calls a function on each interned LGE whose associated string
+// is at least lo and less than hi, in increasing order, until the function
+// returns false.
+func WalkRangeLGEs(lo, hi string, f func(LGE, string) bool) {
+	for sym, str := range RangeLGEs(lo, hi) {
+		if !f(sym, str) {
+			return
+		}
+	}
+}
+
+// WalkPrefixLGEs calls a function on each interned LGE whose associated
+// string begins with a given prefix, in increasing order, until the function
+// returns false.
+func WalkPrefixLGEs(prefix string, f func(LGE, string) bool) {
+	for sym, str := range PrefixLGEs(prefix) {
+		if !f(sym, str) {
+			return
+		}
+	}
+}
+
+// nearestLGE applies a search function to the LGE tree and returns the LGE
+// associated with the resulting node.  The second return value is false if
+// the search function found no node.
+func nearestLGE(search func(*tree) *tree) (LGE, bool) {
+	lge.RLock()
+	defer lge.RUnlock()
+	t := search(lge.tree)
+	if t == nil {
+		return 0, false
+	}
+	return LGE(t.sym), true
+}
+
+// FloorLGE returns the interned LGE whose string is the greatest string less
+// than or equal to a given string.  The given string need not itself have
+// been interned.  The second return value is false if there is no such LGE.
+func FloorLGE(s string) (LGE, bool) {
+	return nearestLGE(func(t *tree) *tree { return t.floor(s) })
+}
+
+// CeilingLGE returns the interned LGE whose string is the least string greater
+// than or equal to a given string.  The given string need not itself have
+// been interned.  The second return value is false if there is no such LGE.
+func CeilingLGE(s string) (LGE, bool) {
+	return nearestLGE(func(t *tree) *tree { return t.ceiling(s) })
+}
+
+// Successor returns the least interned LGE that is greater than a given LGE.
+// The second return value is false if there is no such LGE.
+func (s LGE) Successor() (LGE, bool) {
+	return nearestLGE(func(t *tree) *tree { return t.next(symbol(s)) })
+}
+
+// Predecessor returns the greatest interned LGE that is less than a given LGE.
+// The second return value is false if there is no such LGE.
+func (s LGE) Predecessor() (LGE, bool) {
+	return nearestLGE(func(t *tree) *tree { return t.prev(symbol(s)) })
+}
+
+// NumLGEs returns the number of strings that have been interned as LGEs.
+// Strings passed to PreLGE but not yet passed to NewLGE are not included.
+func NumLGEs() int {
+	lge.RLock()
+	defer lge.RUnlock()
+	return lge.tree.count()
+}
+
+// Rank returns the number of interned LGEs that are less than a given LGE.
+// Hence, the least interned LGE has rank 0.  The given LGE need not itself
+// have been interned.
+func (s LGE) Rank() int {
+	lge.RLock()
+	defer lge.RUnlock()
+	return lge.tree.rank(symbol(s))
+}
+
+// SelectLGE returns the interned LGE with rank k, that is, the (k+1)-th
+// smallest interned LGE.  It panics if k is not in the range [0, NumLGEs()).
+func SelectLGE(k int) LGE {
+	lge.RLock()
+	defer lge.RUnlock()
+	t := lge.tree.nth(k)
+	if t == nil {
+		panic(fmt.Sprintf("%d is not a valid intern.LGE rank", k))
+	}
+	return LGE(t.sym)
+}
+
+// SplitLGEs returns n-1 LGEs that divide the interned LGEs into n ranges of
+// nearly equal size.  The i-th range (starting from 0) consists of those LGEs
+// that are at least the (i-1)-th split point and less than the i-th split
+// point, with the first and last ranges unbounded below and above,
+// respectively.  Hence, an LGE can be assigned to a range using only integer
+// comparisons (see ShardLGE).  Some ranges may be empty if there are fewer
+// than n interned LGEs.  SplitLGEs returns nil if n < 2 or if no LGEs have
+// been interned.
+func SplitLGEs(n int) []LGE {
+	lge.RLock()
+	defer lge.RUnlock()
+	total := lge.tree.count()
+	if n < 2 || total == 0 {
+		return nil
+	}
+	splits := make([]LGE, n-1)
+	for i := range splits {
+		k := int(int64(i+1) * int64(total) / int64(n))
+		splits[i] = LGE(lge.tree.nth(k).sym)
+	}
+	return splits
+}
+
+// SplitLGEsWeighted is like SplitLGEs but divides the interned LGEs into n
+// ranges of nearly equal total weight, as computed by a given function.  The
+// function must return a non-negative weight.  If all weights are zero,
+// SplitLGEsWeighted behaves like SplitLGEs.
+func SplitLGEsWeighted(n int, weight func(LGE, string) float64) []LGE {
+	// Compute the weight of each LGE.
+	if n < 2 {
+		return nil
+	}
+	ps := collectLGEs("", func(string) bool { return true })
+	if len(ps) == 0 {
+		return nil
+	}
+	ws := make([]float64, len(ps))
+	total := 0.0
+	for i, p := range ps {
+		ws[i] = weight(p.sym, p.str)
+		total += ws[i]
+	}
+	if total <= 0 {
+		for i := range ws {
+			ws[i] = 1
+		}
+		total = float64(len(ws))
+	}
+
+	// Each split point is the LGE whose weight spans the corresponding
+	// fraction of the total weight.
+	splits := make([]LGE, 0, n-1)
+	cum := 0.0
+	for i, p := range ps {
+		cum += ws[i]
+		for len(splits) < n-1 && cum > total*float64(len(splits)+1)/float64(n) {
+			splits = append(splits, p.sym)
+		}
+	}
+	for len(splits) < n-1 {
+		splits = append(splits, ps[len(ps)-1].sym)
+	}
+	return splits
+}
+
+// ShardLGE returns the index of the range to which an LGE belongs given a list
+// of split points such as that returned by SplitLGEs.  The result lies in the
+// range [0, len(splits)].
+func ShardLGE(s LGE, splits []LGE) int {
+	return sort.Search(len(splits), func(i int) bool { return splits[i] > s })
+}
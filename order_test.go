@@ -0,0 +1,255 @@
+// This file provides unit tests for ordered queries over LGEs.
+
+package intern_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// sortedOzChars returns a sorted copy of ozChars.
+func sortedOzChars() []string {
+	strs := make([]string, len(ozChars))
+	copy(strs, ozChars)
+	sort.Strings(strs)
+	return strs
+}
+
+// internOzChars replaces all existing LGEs with LGEs for ozChars.
+func internOzChars(t *testing.T) {
+	intern.ForgetAllLGEs()
+	intern.PreLGEMulti(ozChars)
+	_, err := intern.NewLGEMulti(ozChars)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkLGEs ensures that a list of LGEs matches a list of expected strings.
+func checkLGEs(t *testing.T, syms []intern.LGE, strs []string, exp []string) {
+	t.Helper()
+	if len(strs) != len(exp) {
+		t.Fatalf("Expected %d strings but saw %d", len(exp), len(strs))
+	}
+	for i, s := range exp {
+		if strs[i] != s {
+			t.Fatalf("Expected %q but saw %q", s, strs[i])
+		}
+		if syms[i].String() != s {
+			t.Fatalf("Expected %q but saw %q", s, syms[i])
+		}
+		if i > 0 && syms[i-1] >= syms[i] {
+			t.Fatalf("LGEs %d and %d are out of order", syms[i-1], syms[i])
+		}
+	}
+}
+
+// TestAllLGEs tests that we can iterate over all LGEs in order.
+func TestAllLGEs(t *testing.T) {
+	internOzChars(t)
+	var syms []intern.LGE
+	var strs []string
+	for sym, str := range intern.AllLGEs() {
+		syms = append(syms, sym)
+		strs = append(strs, str)
+	}
+	checkLGEs(t, syms, strs, sortedOzChars())
+}
+
+// TestRangeLGEs tests that we can iterate over a range of LGEs in order.
+func TestRangeLGEs(t *testing.T) {
+	internOzChars(t)
+	var exp []string
+	for _, s := range sortedOzChars() {
+		if s >= "Glinda" && s < "Jester" {
+			exp = append(exp, s)
+		}
+	}
+	var syms []intern.LGE
+	var strs []string
+	intern.WalkRangeLGEs("Glinda", "Jester", func(sym intern.LGE, str string) bool {
+		syms = append(syms, sym)
+		strs = append(strs, str)
+		return true
+	})
+	checkLGEs(t, syms, strs, exp)
+}
+
+// TestPrefixLGEs tests that we can iterate over all LGEs with a given prefix.
+func TestPrefixLGEs(t *testing.T) {
+	internOzChars(t)
+	var exp []string
+	for _, s := range sortedOzChars() {
+		if strings.HasPrefix(s, "King") {
+			exp = append(exp, s)
+		}
+	}
+	var syms []intern.LGE
+	var strs []string
+	for sym, str := range intern.PrefixLGEs("King") {
+		syms = append(syms, sym)
+		strs = append(strs, str)
+	}
+	checkLGEs(t, syms, strs, exp)
+
+	// Ensure that we can stop early.
+	n := 0
+	intern.WalkPrefixLGEs("King", func(intern.LGE, string) bool {
+		n++
+		return n < 2
+	})
+	if n != 2 {
+		t.Fatalf("Expected 2 calls but saw %d", n)
+	}
+}
+
+// TestFloorCeilingLGE tests that we can find the nearest LGE to an arbitrary
+// string.
+func TestFloorCeilingLGE(t *testing.T) {
+	internOzChars(t)
+	for _, tc := range []struct {
+		str   string // String to look up
+		floor string // Expected floor ("" if none)
+		ceil  string // Expected ceiling ("" if none)
+	}{
+		{"Glinda", "Glinda", "Glinda"},
+		{"Glob", "Glinda", "Good Witch of the North"},
+		{"A", "", "A-B-Sea Serpent"},
+		{"Zzz", "Zeb Hugson", ""},
+	} {
+		for _, f := range []struct {
+			name string                          // Name of the function
+			fn   func(string) (intern.LGE, bool) // Function to test
+			exp  string                          // Expected string
+		}{
+			{"FloorLGE", intern.FloorLGE, tc.floor},
+			{"CeilingLGE", intern.CeilingLGE, tc.ceil},
+		} {
+			sym, ok := f.fn(tc.str)
+			switch {
+			case !ok && f.exp != "":
+				t.Fatalf("%s(%q) found nothing but should have found %q", f.name, tc.str, f.exp)
+			case ok && f.exp == "":
+				t.Fatalf("%s(%q) found %q but should have found nothing", f.name, tc.str, sym)
+			case ok && sym.String() != f.exp:
+				t.Fatalf("%s(%q) found %q but should have found %q", f.name, tc.str, sym, f.exp)
+			}
+		}
+	}
+}
+
+// TestLGESuccessorPredecessor tests that we can walk the LGEs in both
+// directions one step at a time.
+func TestLGESuccessorPredecessor(t *testing.T) {
+	internOzChars(t)
+	exp := sortedOzChars()
+
+	// Walk forward.
+	sym, ok := intern.CeilingLGE("")
+	for i, s := range exp {
+		if !ok || sym.String() != s {
+			t.Fatalf("Expected %q at position %d", s, i)
+		}
+		sym, ok = sym.Successor()
+	}
+	if ok {
+		t.Fatalf("Unexpected successor %q", sym)
+	}
+
+	// Walk backward.
+	sym, ok = intern.FloorLGE("\U0010FFFF")
+	for i := len(exp) - 1; i >= 0; i-- {
+		if !ok || sym.String() != exp[i] {
+			t.Fatalf("Expected %q at position %d", exp[i], i)
+		}
+		sym, ok = sym.Predecessor()
+	}
+	if ok {
+		t.Fatalf("Unexpected predecessor %q", sym)
+	}
+}
+
+// TestLGERankSelect tests that Rank and SelectLGE agree with the sorted order
+// of the interned strings, even after LGEs are remapped.
+func TestLGERankSelect(t *testing.T) {
+	// Intern strings in reverse order to force remapping.
+	intern.ForgetAllLGEs()
+	defer intern.ForgetAllLGEs()
+	exp := sortedOzChars()
+	for i := len(exp) - 1; i >= 0; i-- {
+		_, err := intern.NewLGE(exp[i])
+		if err != nil {
+			intern.PreLGE(exp[i])
+			_, err = intern.RemapSomeLGEs()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Ensure that ranks and selections match the sorted string order.
+	if n := intern.NumLGEs(); n != len(exp) {
+		t.Fatalf("Expected %d LGEs but saw %d", len(exp), n)
+	}
+	for i, s := range exp {
+		sym := intern.SelectLGE(i)
+		if sym.String() != s {
+			t.Fatalf("Expected SelectLGE(%d) to return %q but saw %q", i, s, sym)
+		}
+		if r := sym.Rank(); r != i {
+			t.Fatalf("Expected %q to have rank %d but saw %d", s, i, r)
+		}
+	}
+
+	// Ensure that SelectLGE panics when given an invalid rank.
+	defer func() { _ = recover() }()
+	sym := intern.SelectLGE(len(exp))
+	t.Fatalf("Failed to catch invalid rank %d (%d)", len(exp), sym)
+}
+
+// checkSplits ensures that a set of split points divides the interned LGEs
+// into ranges whose total weights are no more than a given amount.
+func checkSplits(t *testing.T, splits []intern.LGE, n int, weight func(string) int, max int) {
+	t.Helper()
+	if len(splits) != n-1 {
+		t.Fatalf("Expected %d split points but saw %d", n-1, len(splits))
+	}
+	ws := make([]int, n)
+	for sym, str := range intern.AllLGEs() {
+		ws[intern.ShardLGE(sym, splits)] += weight(str)
+	}
+	for i, w := range ws {
+		if w > max {
+			t.Fatalf("Range %d has weight %d, which exceeds %d (weights: %v)", i, w, max, ws)
+		}
+	}
+}
+
+// TestSplitLGEs tests that we can divide the LGEs into balanced ranges.
+func TestSplitLGEs(t *testing.T) {
+	internOzChars(t)
+	const n = 7
+	nStrs := len(ozChars)
+	checkSplits(t, intern.SplitLGEs(n), n, func(string) int { return 1 }, (nStrs+n-1)/n)
+}
+
+// TestSplitLGEsWeighted tests that we can divide the LGEs into ranges of
+// balanced weight.
+func TestSplitLGEsWeighted(t *testing.T) {
+	internOzChars(t)
+	const n = 5
+	total, most := 0, 0
+	for _, s := range ozChars {
+		total += len(s)
+		if len(s) > most {
+			most = len(s)
+		}
+	}
+	splits := intern.SplitLGEsWeighted(n, func(_ intern.LGE, s string) float64 {
+		return float64(len(s))
+	})
+	checkSplits(t, splits, n, func(s string) int { return len(s) }, total/n+most)
+}
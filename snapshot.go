@@ -0,0 +1,188 @@
+// This file provides immutable snapshots of the Eq and LGE tables.
+
+package intern
+
+import (
+	"iter"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An EqSnapshot is an immutable copy of the Eq table as it existed at a
+// particular point in time.  An EqSnapshot can be queried and iterated
+// without acquiring any locks and is unaffected by subsequent calls to NewEq
+// or ForgetAllEqs.
+type EqSnapshot struct {
+	ms       []EqMapping   // All mappings in allocation order
+	syms     map[string]Eq // Mapping from strings to Eqs, built on demand
+	symsOnce sync.Once     // Guard for building syms
+}
+
+// SnapshotEqs returns a snapshot of the current Eq table.
+func SnapshotEqs() *EqSnapshot {
+	return &EqSnapshot{ms: ExportEqs()}
+}
+
+// Len returns the number of Eqs in a snapshot.
+func (ss *EqSnapshot) Len() int {
+	return len(ss.ms)
+}
+
+// All returns an iterator over all Eqs in a snapshot and their associated
+// strings in the order in which the Eqs were allocated.
+func (ss *EqSnapshot) All() iter.Seq2[Eq, string] {
+	return func(yield func(Eq, string) bool) {
+		for _, m := range ss.ms {
+			if !yield(m.Sym, m.Str) {
+				return
+			}
+		}
+	}
+}
+
+// Lookup returns the Eq associated with a string in a snapshot.  The second
+// return value is false if the string had not been interned when the snapshot
+// was taken.
+func (ss *EqSnapshot) Lookup(s string) (Eq, bool) {
+	ss.symsOnce.Do(func() {
+		ss.syms = make(map[string]Eq, len(ss.ms))
+		for _, m := range ss.ms {
+			ss.syms[m.Str] = m.Sym
+		}
+	})
+	sym, ok := ss.syms[s]
+	return sym, ok
+}
+
+// Str returns the string associated with an Eq in a snapshot.  The second
+// return value is false if the Eq had not been allocated when the snapshot
+// was taken.
+func (ss *EqSnapshot) Str(sym Eq) (string, bool) {
+	i := sort.Search(len(ss.ms), func(i int) bool { return ss.ms[i].Sym >= sym })
+	if i < len(ss.ms) && ss.ms[i].Sym == sym {
+		return ss.ms[i].Str, true
+	}
+	return "", false
+}
+
+// Diff compares a snapshot to an older snapshot and returns the strings that
+// were added since the older snapshot was taken, in allocation order, and the
+// strings that have since been forgotten, in the older snapshot's allocation
+// order.
+func (ss *EqSnapshot) Diff(old *EqSnapshot) (added, removed []string) {
+	for _, m := range ss.ms {
+		if _, ok := old.Lookup(m.Str); !ok {
+			added = append(added, m.Str)
+		}
+	}
+	for _, m := range old.ms {
+		if _, ok := ss.Lookup(m.Str); !ok {
+			removed = append(removed, m.Str)
+		}
+	}
+	return added, removed
+}
+
+// An LGESnapshot is an immutable copy of the LGE table as it existed at a
+// particular point in time.  An LGESnapshot can be queried and iterated
+// without acquiring any locks and is unaffected by subsequent calls to NewLGE,
+// RemapAllLGEs, or any other function that modifies the LGE table.
+type LGESnapshot struct {
+	ps []lgePair // All LGEs and their strings in increasing order
+}
+
+// SnapshotLGEs returns a snapshot of the current LGE table.  Strings passed
+// to PreLGE but not yet passed to NewLGE are not included.
+func SnapshotLGEs() *LGESnapshot {
+	return &LGESnapshot{ps: collectLGEs("", func(string) bool { return true })}
+}
+
+// Len returns the number of LGEs in a snapshot.
+func (ss *LGESnapshot) Len() int {
+	return len(ss.ps)
+}
+
+// seq returns an iterator over a subslice of a snapshot's LGEs.
+func (ss *LGESnapshot) seq(ps []lgePair) iter.Seq2[LGE, string] {
+	return func(yield func(LGE, string) bool) {
+		for _, p := range ps {
+			if !yield(p.sym, p.str) {
+				return
+			}
+		}
+	}
+}
+
+// search returns the index of the first LGE in a snapshot whose string is at
+// least a given string.
+func (ss *LGESnapshot) search(s string) int {
+	return sort.Search(len(ss.ps), func(i int) bool { return ss.ps[i].str >= s })
+}
+
+// All returns an iterator over all LGEs in a snapshot and their associated
+// strings in increasing order.
+func (ss *LGESnapshot) All() iter.Seq2[LGE, string] {
+	return ss.seq(ss.ps)
+}
+
+// Range returns an iterator over all LGEs in a snapshot whose associated
+// strings are at least lo and less than hi, in increasing order.
+func (ss *LGESnapshot) Range(lo, hi string) iter.Seq2[LGE, string] {
+	i := ss.search(lo)
+	j := i + sort.Search(len(ss.ps)-i, func(k int) bool { return ss.ps[i+k].str >= hi })
+	return ss.seq(ss.ps[i:j])
+}
+
+// Prefix returns an iterator over all LGEs in a snapshot whose associated
+// strings begin with a given prefix, in increasing order.
+func (ss *LGESnapshot) Prefix(prefix string) iter.Seq2[LGE, string] {
+	i := ss.search(prefix)
+	j := i
+	for j < len(ss.ps) && strings.HasPrefix(ss.ps[j].str, prefix) {
+		j++
+	}
+	return ss.seq(ss.ps[i:j])
+}
+
+// Lookup returns the LGE associated with a string in a snapshot.  The second
+// return value is false if the string had not been interned when the snapshot
+// was taken.
+func (ss *LGESnapshot) Lookup(s string) (LGE, bool) {
+	i := ss.search(s)
+	if i < len(ss.ps) && ss.ps[i].str == s {
+		return ss.ps[i].sym, true
+	}
+	return 0, false
+}
+
+// Str returns the string associated with an LGE in a snapshot.  The second
+// return value is false if the LGE did not exist when the snapshot was taken.
+func (ss *LGESnapshot) Str(sym LGE) (string, bool) {
+	i := sort.Search(len(ss.ps), func(i int) bool { return ss.ps[i].sym >= sym })
+	if i < len(ss.ps) && ss.ps[i].sym == sym {
+		return ss.ps[i].str, true
+	}
+	return "", false
+}
+
+// Diff compares a snapshot to an older snapshot and returns, in increasing
+// order, the strings that were added since the older snapshot was taken and
+// the strings that have since been forgotten.
+func (ss *LGESnapshot) Diff(old *LGESnapshot) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(ss.ps) || j < len(old.ps) {
+		switch {
+		case j == len(old.ps) || (i < len(ss.ps) && ss.ps[i].str < old.ps[j].str):
+			added = append(added, ss.ps[i].str)
+			i++
+		case i == len(ss.ps) || old.ps[j].str < ss.ps[i].str:
+			removed = append(removed, old.ps[j].str)
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return added, removed
+}
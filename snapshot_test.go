@@ -0,0 +1,101 @@
+// This file provides unit tests for snapshots of the Eq and LGE tables.
+
+package intern_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// TestEqSnapshot tests that an Eq snapshot is unaffected by subsequent
+// changes to the Eq table.
+func TestEqSnapshot(t *testing.T) {
+	// Take a snapshot then intern some more strings.
+	intern.ForgetAllEqs()
+	syms := intern.NewEqMulti(ozChars[:50])
+	old := intern.SnapshotEqs()
+	_ = intern.NewEqMulti(ozChars[40:])
+
+	// Ensure that the snapshot contains only the original strings.
+	if old.Len() != 50 {
+		t.Fatalf("Expected 50 Eqs but saw %d", old.Len())
+	}
+	for i, s := range ozChars {
+		sym, ok := old.Lookup(s)
+		switch {
+		case i < 50 && (!ok || sym != syms[i]):
+			t.Fatalf("Expected %q to map to %d but saw %d", s, syms[i], sym)
+		case i >= 50 && ok:
+			t.Fatalf("Unexpectedly found %q in the snapshot", s)
+		}
+	}
+	for i, sym := range syms {
+		str, ok := old.Str(sym)
+		if !ok || str != ozChars[i] {
+			t.Fatalf("Expected %d to map to %q but saw %q", sym, ozChars[i], str)
+		}
+	}
+
+	// Ensure that we can see what changed.
+	added, removed := intern.SnapshotEqs().Diff(old)
+	if strings.Join(added, "|") != strings.Join(ozChars[50:], "|") {
+		t.Fatalf("Expected %q to have been added but saw %q", ozChars[50:], added)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("Expected nothing to have been removed but saw %q", removed)
+	}
+}
+
+// TestLGESnapshot tests that an LGE snapshot is unaffected by subsequent
+// changes to the LGE table.
+func TestLGESnapshot(t *testing.T) {
+	// Take a snapshot then remap all LGEs.
+	internOzChars(t)
+	old := intern.SnapshotLGEs()
+	oldSyms := make(map[string]intern.LGE, len(ozChars))
+	for sym, str := range intern.AllLGEs() {
+		oldSym, ok := old.Lookup(str)
+		if !ok || oldSym != sym {
+			t.Fatalf("Expected %q to map to %d but saw %d", str, sym, oldSym)
+		}
+		oldSyms[str] = sym
+	}
+	intern.PreLGE("Zzyzx")
+	_, err := intern.RemapAllLGEs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure that the snapshot is unchanged.
+	var strs []string
+	for sym, str := range old.All() {
+		if s, ok := old.Str(sym); !ok || s != str {
+			t.Fatalf("Expected %d to map to %q but saw %q", sym, str, s)
+		}
+		if oldSyms[str] != sym {
+			t.Fatalf("Expected %q to map to %d but saw %d", str, oldSyms[str], sym)
+		}
+		strs = append(strs, str)
+	}
+	if strings.Join(strs, "|") != strings.Join(sortedOzChars(), "|") {
+		t.Fatal("Snapshot strings do not match the original strings")
+	}
+	n := 0
+	for _, str := range old.Prefix("Wicked") {
+		if !strings.HasPrefix(str, "Wicked") {
+			t.Fatalf("Unexpected string %q", str)
+		}
+		n++
+	}
+	if n != 4 {
+		t.Fatalf("Expected 4 strings with prefix \"Wicked\" but saw %d", n)
+	}
+
+	// Ensure that we can see what changed.
+	added, removed := intern.SnapshotLGEs().Diff(old)
+	if len(added) != 1 || added[0] != "Zzyzx" || len(removed) != 0 {
+		t.Fatalf("Expected [\"Zzyzx\"] and [] but saw %q and %q", added, removed)
+	}
+}
@@ -0,0 +1,107 @@
+// This file provides support for storing Eqs and LGEs in SQL databases.
+
+package intern
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// sqlValue converts a symbol to a value that can be stored in an SQL
+// database: either the symbol's string or, in numeric mode, the symbol itself
+// reinterpreted as an int64.  It returns a PkgError with code ErrInvalid if
+// the symbol is invalid, as is the zero value.
+func (st *state) sqlValue(s symbol, ty string) (driver.Value, error) {
+	str, err := st.checkedString(s, ty)
+	if err != nil {
+		return nil, err
+	}
+	if st.sqlNum.Load() {
+		return int64(s), nil
+	}
+	return str, nil
+}
+
+// sqlScan converts a value read from an SQL database to a symbol.  Strings
+// and byte slices are interned as by UnmarshalText; integers are taken to be
+// symbols stored in numeric mode.
+func (st *state) sqlScan(src any, ty string, assign func(string) (symbol, error)) (symbol, error) {
+	switch v := src.(type) {
+	case string:
+		return st.unmarshal([]byte(v), ty, assign)
+	case []byte:
+		return st.unmarshal(v, ty, assign)
+	case int64:
+		sym := symbol(v)
+		if _, err := st.checkedString(sym, ty); err != nil {
+			return 0, err
+		}
+		return sym, nil
+	case nil:
+		return 0, fmt.Errorf("cannot scan NULL into an intern.%s", ty)
+	default:
+		return 0, fmt.Errorf("cannot scan a %T into an intern.%s", src, ty)
+	}
+}
+
+// Value converts an Eq to a value that can be stored in an SQL database.  By
+// default, the value is the Eq's string.  See SetEqSQLNumeric for an
+// alternative.  With this method, Eq implements the driver.Valuer interface.
+// Value returns a PkgError with code ErrInvalid if given the zero Eq or any
+// other Eq not associated with a string.
+func (s Eq) Value() (driver.Value, error) {
+	return eq.sqlValue(symbol(s), "Eq")
+}
+
+// Scan converts a value read from an SQL database to an Eq.  A string is
+// interned as by UnmarshalText, and an integer is taken to be an Eq stored
+// in numeric mode.  With this method, Eq implements the sql.Scanner
+// interface.
+func (s *Eq) Scan(src any) error {
+	sym, err := eq.sqlScan(src, "Eq", tryNewEqSymbol)
+	if err != nil {
+		return err
+	}
+	*s = Eq(sym)
+	return nil
+}
+
+// SetEqSQLNumeric specifies whether Eq.Value stores Eqs in SQL databases as
+// strings (the default) or as integers.  Integers are more compact but are
+// meaningful only as long as the Eq table itself is persisted, for example
+// with WriteEqs.  Eq.Scan accepts both forms regardless of this setting.
+func SetEqSQLNumeric(numeric bool) {
+	eq.sqlNum.Store(numeric)
+}
+
+// Value converts an LGE to a value that can be stored in an SQL database.  By
+// default, the value is the LGE's string.  See SetLGESQLNumeric for an
+// alternative.  With this method, LGE implements the driver.Valuer interface.
+// Value returns a PkgError with code ErrInvalid if given the zero LGE or any
+// other LGE not associated with a string.
+func (s LGE) Value() (driver.Value, error) {
+	return lge.sqlValue(symbol(s), "LGE")
+}
+
+// Scan converts a value read from an SQL database to an LGE.  A string is
+// interned as by UnmarshalText, and an integer is taken to be an LGE stored
+// in numeric mode.  With this method, LGE implements the sql.Scanner
+// interface.
+func (s *LGE) Scan(src any) error {
+	sym, err := lge.sqlScan(src, "LGE", newLGESymbol)
+	if err != nil {
+		return err
+	}
+	*s = LGE(sym)
+	return nil
+}
+
+// SetLGESQLNumeric specifies whether LGE.Value stores LGEs in SQL databases
+// as strings (the default) or as integers.  Because SQL integers are signed,
+// LGEs are stored as their 64-bit two's-complement reinterpretation, which
+// does not preserve order.  Integers are meaningful only as long as the LGE
+// table itself is persisted.  LGE.Scan accepts both forms regardless of this
+// setting.
+func SetLGESQLNumeric(numeric bool) {
+	lge.sqlNum.Store(numeric)
+}
@@ -0,0 +1,216 @@
+// This file provides unit tests for storing Eqs and LGEs in SQL databases.
+
+package intern_test
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// A fakeDB is an in-memory database consisting of a single table.  Every
+// statement that takes arguments inserts them as a new row, and every
+// statement that takes no arguments selects all rows.
+type fakeDB struct {
+	rows       [][]driver.Value // Contents of the table
+	sync.Mutex                  // Mutex protecting the above
+}
+
+// fakeDriver implements driver.Driver for a fakeDB.
+type fakeDriver struct {
+	db *fakeDB
+}
+
+// Open returns a connection to a fakeDB.
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn(d), nil }
+
+// fakeConn implements driver.Conn for a fakeDB.
+type fakeConn fakeDriver
+
+// Prepare returns a statement for a fakeDB.
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt(c), nil }
+
+// Close does nothing.
+func (c fakeConn) Close() error { return nil }
+
+// Begin is not supported.
+func (c fakeConn) Begin() (driver.Tx, error) { return nil, driver.ErrSkip }
+
+// fakeStmt implements driver.Stmt for a fakeDB.
+type fakeStmt fakeConn
+
+// Close does nothing.
+func (s fakeStmt) Close() error { return nil }
+
+// NumInput returns -1 to accept any number of arguments.
+func (s fakeStmt) NumInput() int { return -1 }
+
+// Exec inserts a row into a fakeDB.
+func (s fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+	s.db.rows = append(s.db.rows, args)
+	return driver.RowsAffected(1), nil
+}
+
+// Query returns all rows in a fakeDB.
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error) {
+	s.db.Lock()
+	defer s.db.Unlock()
+	return &fakeRows{rows: append([][]driver.Value(nil), s.db.rows...)}, nil
+}
+
+// fakeRows implements driver.Rows for a fakeDB.
+type fakeRows struct {
+	rows [][]driver.Value // Rows not yet returned
+}
+
+// Columns returns the names of a fakeDB's columns.
+func (r *fakeRows) Columns() []string { return []string{"sym", "num"} }
+
+// Close does nothing.
+func (r *fakeRows) Close() error { return nil }
+
+// Next returns the next row.
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+// fakeDBs maps each registered driver name to its fakeDB.
+var fakeDBs sync.Map
+
+// openFakeDB registers a fakeDB with database/sql if not already registered,
+// empties it, and opens it.
+func openFakeDB(t *testing.T, name string) (*sql.DB, *fakeDB) {
+	t.Helper()
+	v, loaded := fakeDBs.LoadOrStore(name, &fakeDB{})
+	fdb := v.(*fakeDB)
+	if !loaded {
+		sql.Register(name, fakeDriver{db: fdb})
+	}
+	fdb.rows = nil
+	db, err := sql.Open(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, fdb
+}
+
+// TestEqSQL tests that Eqs can be written to and read from an SQL database
+// both as strings and as integers.
+func TestEqSQL(t *testing.T) {
+	for _, numeric := range []bool{false, true} {
+		intern.ForgetAllEqs()
+		intern.SetEqSQLNumeric(numeric)
+		db, fdb := openFakeDB(t, "intern-eq-"+map[bool]string{false: "str", true: "num"}[numeric])
+		syms := intern.NewEqMulti(ozChars)
+		for i, sym := range syms {
+			_, err := db.Exec("INSERT", sym, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, isStr := fdb.rows[0][0].(string); isStr == numeric {
+			t.Fatalf("Unexpected stored type %T (numeric = %v)", fdb.rows[0][0], numeric)
+		}
+		rows, err := db.Query("SELECT")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var sym intern.Eq
+			var i int
+			err = rows.Scan(&sym, &i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sym != syms[i] {
+				t.Fatalf("Expected %q but saw %q", syms[i], sym)
+			}
+		}
+		if err = rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	intern.SetEqSQLNumeric(false)
+
+	// Ensure that invalid values are rejected.
+	var sym intern.Eq
+	for _, v := range []any{nil, 3.14, int64(len(ozChars) + 1)} {
+		if sym.Scan(v) == nil {
+			t.Fatalf("Failed to reject %#v", v)
+		}
+	}
+	checkInvalidValue(t, intern.Eq(0), intern.SetEqSQLNumeric)
+}
+
+// checkInvalidValue ensures that Value returns an ErrInvalid PkgError instead
+// of panicking when given an invalid symbol.
+func checkInvalidValue(t *testing.T, sym driver.Valuer, setNumeric func(bool)) {
+	t.Helper()
+	defer setNumeric(false)
+	for _, numeric := range []bool{false, true} {
+		setNumeric(numeric)
+		v, err := sym.Value()
+		if v != nil {
+			t.Fatalf("Expected nil but saw %#v (numeric = %v)", v, numeric)
+		}
+		if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrInvalid {
+			t.Fatalf("Expected ErrInvalid but saw %v (numeric = %v)", err, numeric)
+		}
+	}
+}
+
+// TestLGESQL tests that LGEs can be written to and read from an SQL database
+// both as strings and as integers.
+func TestLGESQL(t *testing.T) {
+	for _, numeric := range []bool{false, true} {
+		intern.ForgetAllLGEs()
+		intern.SetLGESQLNumeric(numeric)
+		db, fdb := openFakeDB(t, "intern-lge-"+map[bool]string{false: "str", true: "num"}[numeric])
+		intern.PreLGEMulti(ozChars)
+		syms, err := intern.NewLGEMulti(ozChars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, sym := range syms {
+			_, err = db.Exec("INSERT", sym, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, isStr := fdb.rows[0][0].(string); isStr == numeric {
+			t.Fatalf("Unexpected stored type %T (numeric = %v)", fdb.rows[0][0], numeric)
+		}
+		rows, err := db.Query("SELECT")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var sym intern.LGE
+			var i int
+			err = rows.Scan(&sym, &i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sym != syms[i] {
+				t.Fatalf("Expected %q but saw %q", syms[i], sym)
+			}
+		}
+		if err = rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	intern.SetLGESQLNumeric(false)
+	checkInvalidValue(t, intern.LGE(0), intern.SetLGESQLNumeric)
+}
@@ -0,0 +1,88 @@
+// This file gathers usage statistics for the Eq and LGE tables.
+
+package intern
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats reports the size of a symbol table and counts the operations
+// performed on it.  The counts accumulate over the life of the program and
+// are not reset by ForgetAllEqs, ForgetAllLGEs, ReadEqs, or ReadLGEs.
+type Stats struct {
+	Symbols  int           // Number of interned strings
+	Bytes    int           // Total length in bytes of all interned strings
+	Pending  int           // Number of strings passed to PreLGE but not yet interned
+	Frozen   bool          // true if the table is frozen
+	Hits     uint64        // Requests to intern a string that was already interned
+	Misses   uint64        // Requests that interned a new string
+	Failures uint64        // Requests that failed to intern a string
+	Remaps   uint64        // Number of times existing symbols were reassigned
+	LockWait time.Duration // Total time spent waiting to modify the table
+}
+
+// counters accumulates the operation counts reported in a Stats.
+type counters struct {
+	hits     atomic.Uint64 // Requests for already interned strings
+	misses   atomic.Uint64 // Requests that interned new strings
+	failures atomic.Uint64 // Requests that failed
+	remaps   atomic.Uint64 // Reassignments of existing symbols
+	lockWait atomic.Int64  // Nanoseconds spent waiting for the write lock
+}
+
+// record counts a single request to intern a string, given whether the
+// string was already interned and the request's error status.
+func (c *counters) record(existed bool, err error) {
+	switch {
+	case err != nil:
+		c.failures.Add(1)
+	case existed:
+		c.hits.Add(1)
+	default:
+		c.misses.Add(1)
+	}
+}
+
+// lock acquires a state's write lock, accumulating the time spent waiting for
+// it.  The uncontended case avoids reading the clock.
+func (st *state) lock() {
+	if st.TryLock() {
+		return
+	}
+	start := time.Now()
+	st.Lock()
+	st.counts.lockWait.Add(int64(time.Since(start)))
+}
+
+// getStats returns a state's current statistics.
+func (st *state) getStats() Stats {
+	st.RLock()
+	s := Stats{
+		Symbols: st.size(),
+		Bytes:   st.nbytes,
+		Pending: len(st.pending),
+		Frozen:  st.frozen.Load() != nil,
+	}
+	st.RUnlock()
+	s.Hits = st.counts.hits.Load()
+	s.Misses = st.counts.misses.Load()
+	s.Failures = st.counts.failures.Load()
+	s.Remaps = st.counts.remaps.Load()
+	s.LockWait = time.Duration(st.counts.lockWait.Load())
+	return s
+}
+
+// EqStats returns statistics for the Eq table.  Requests to intern a string
+// include calls to NewEq, TryNewEq, NewEqMulti (one per string), NewEqBytes,
+// TryNewEqBytes, Canonical, and CanonicalBytes.
+func EqStats() Stats {
+	return eq.getStats()
+}
+
+// LGEStats returns statistics for the LGE table.  Requests to intern a string
+// include calls to NewLGE, NewLGEBytes, and NewLGEMulti (one per string,
+// except that a failed call counts as a single failure).
+func LGEStats() Stats {
+	return lge.getStats()
+}
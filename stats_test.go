@@ -0,0 +1,82 @@
+// This file provides unit tests for symbol-table statistics.
+
+package intern_test
+
+import (
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// TestEqStats ensures that EqStats reports the size of the Eq table and
+// counts hits, misses, and failures.
+func TestEqStats(t *testing.T) {
+	intern.ForgetAllEqs()
+	before := intern.EqStats()
+	intern.NewEqMulti([]string{"cat", "dog", "cat"})
+	intern.NewEqBytes([]byte("dog"))
+	intern.FreezeEqs()
+	_, _ = intern.TryNewEq("cat")
+	_, _ = intern.TryNewEq("emu")
+	after := intern.EqStats()
+	intern.ForgetAllEqs()
+	if after.Symbols != 2 || after.Bytes != 6 || !after.Frozen {
+		t.Fatalf("Unexpected Eq statistics %+v", after)
+	}
+	if h := after.Hits - before.Hits; h != 3 {
+		t.Fatalf("Expected 3 hits but saw %d", h)
+	}
+	if m := after.Misses - before.Misses; m != 2 {
+		t.Fatalf("Expected 2 misses but saw %d", m)
+	}
+	if f := after.Failures - before.Failures; f != 1 {
+		t.Fatalf("Expected 1 failure but saw %d", f)
+	}
+	if s := intern.EqStats(); s.Hits != after.Hits || s.Symbols != 0 || s.Frozen {
+		t.Fatalf("ForgetAllEqs produced unexpected statistics %+v", s)
+	}
+}
+
+// TestLGEStats ensures that LGEStats counts pending strings, failures, and
+// remaps.
+func TestLGEStats(t *testing.T) {
+	intern.ForgetAllLGEs()
+	before := intern.LGEStats()
+	intern.PreLGEMulti([]string{"b", "c"})
+	if p := intern.LGEStats().Pending; p != 2 {
+		t.Fatalf("Expected 2 pending strings but saw %d", p)
+	}
+	_, err := intern.NewLGEMulti([]string{"b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = intern.NewLGE("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add strings in an order that exhausts the space between "b" and "c".
+	var s string
+	for s = "b"; err == nil; {
+		s += "z"
+		_, err = intern.NewLGE(s)
+	}
+	intern.PreLGE(s)
+	_, err = intern.RemapSomeLGEs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := intern.LGEStats()
+	if after.Pending != 0 || after.Symbols != intern.NumLGEs() {
+		t.Fatalf("Unexpected LGE statistics %+v", after)
+	}
+	if h := after.Hits - before.Hits; h != 1 {
+		t.Fatalf("Expected 1 hit but saw %d", h)
+	}
+	if f := after.Failures - before.Failures; f != 1 {
+		t.Fatalf("Expected 1 failure but saw %d", f)
+	}
+	if r := after.Remaps - before.Remaps; r != 1 {
+		t.Fatalf("Expected 1 remap but saw %d", r)
+	}
+}
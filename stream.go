@@ -0,0 +1,244 @@
+// This file provides a compact, dictionary-encoded stream format for Eqs and
+// LGEs.
+
+package intern
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// defaultMaxStreamString is the length of the longest string a Decoder will
+// accept unless told otherwise by SetMaxString.
+const defaultMaxStreamString = 1 << 20
+
+// An Encoder writes a stream of Eqs and LGEs to an io.Writer.  The first time
+// a given string appears in the stream, the Encoder writes the string itself
+// and adds it to a per-stream dictionary.  Every subsequent appearance of the
+// string is written as a varint-encoded reference to the dictionary entry.
+// Hence, streams with many repeated strings are much smaller than they would
+// be if encoded with encoding/gob.  Output is buffered; call Flush when done.
+type Encoder struct {
+	w       *bufio.Writer     // Buffered output stream
+	strRefs map[string]uint64 // Dictionary index of each string written
+	eqRefs  map[Eq]uint64     // Dictionary index of each Eq written
+	lgeRefs map[LGE]uint64    // Dictionary index of each LGE written
+	eqGen   uint64            // Eq table generation to which eqRefs applies
+	lgeGen  uint64            // LGE table generation to which lgeRefs applies
+	buf     []byte            // Scratch space for varints
+}
+
+// NewEncoder returns an Encoder that writes to a given io.Writer.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		w:       bufio.NewWriter(w),
+		strRefs: make(map[string]uint64),
+		eqRefs:  make(map[Eq]uint64),
+		lgeRefs: make(map[LGE]uint64),
+		buf:     make([]byte, 0, binary.MaxVarintLen64),
+	}
+}
+
+// writeUvarint writes an unsigned integer in varint format.
+func (e *Encoder) writeUvarint(v uint64) error {
+	_, err := e.w.Write(binary.AppendUvarint(e.buf[:0], v))
+	return err
+}
+
+// writeString writes a reference to a string, writing the string itself and
+// adding it to the dictionary if not already present.  It returns the
+// string's dictionary index.
+func (e *Encoder) writeString(s string) (uint64, error) {
+	if ref, ok := e.strRefs[s]; ok {
+		return ref, e.writeUvarint(ref)
+	}
+	ref := uint64(len(e.strRefs) + 1)
+	e.strRefs[s] = ref
+	err := e.writeUvarint(0)
+	if err != nil {
+		return 0, err
+	}
+	err = e.writeUvarint(uint64(len(s)))
+	if err != nil {
+		return 0, err
+	}
+	_, err = e.w.WriteString(s)
+	return ref, err
+}
+
+// EncodeEq writes an Eq to the stream.  It returns a PkgError with code
+// ErrInvalid if given the zero Eq or any other Eq not associated with a
+// string.
+func (e *Encoder) EncodeEq(s Eq) error {
+	if gen := eq.gen.Load(); gen != e.eqGen {
+		clear(e.eqRefs)
+		e.eqGen = gen
+	}
+	if ref, ok := e.eqRefs[s]; ok {
+		return e.writeUvarint(ref)
+	}
+	str, err := eq.checkedString(symbol(s), "Eq")
+	if err != nil {
+		return err
+	}
+	ref, err := e.writeString(str)
+	if err != nil {
+		return err
+	}
+	e.eqRefs[s] = ref
+	return nil
+}
+
+// EncodeLGE writes an LGE to the stream.  It returns a PkgError with code
+// ErrInvalid if given the zero LGE or any other LGE not associated with a
+// string.
+func (e *Encoder) EncodeLGE(s LGE) error {
+	if gen := lge.gen.Load(); gen != e.lgeGen {
+		clear(e.lgeRefs)
+		e.lgeGen = gen
+	}
+	if ref, ok := e.lgeRefs[s]; ok {
+		return e.writeUvarint(ref)
+	}
+	str, err := lge.checkedString(symbol(s), "LGE")
+	if err != nil {
+		return err
+	}
+	ref, err := e.writeString(str)
+	if err != nil {
+		return err
+	}
+	e.lgeRefs[s] = ref
+	return nil
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+// A Decoder reads a stream of Eqs and LGEs written by an Encoder, interning
+// each string in the receiver's own Eq or LGE table.  Each string is interned
+// only once per stream and table, no matter how many times it appears.
+// Decoding honors SetEqUnmarshalStrict and SetLGEUnmarshalStrict.
+type Decoder struct {
+	r       *bufio.Reader // Buffered input stream
+	dict    []string      // Dictionary of strings read so far
+	eqSyms  []Eq          // Eq corresponding to each dictionary entry or 0
+	lgeSyms []LGE         // LGE corresponding to each dictionary entry or 0
+	eqGen   uint64        // Eq table generation to which eqSyms applies
+	lgeGen  uint64        // LGE table generation to which lgeSyms applies
+	maxStr  uint64        // Length of the longest string to accept
+}
+
+// NewDecoder returns a Decoder that reads from a given io.Reader.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		r:      bufio.NewReader(r),
+		maxStr: defaultMaxStreamString,
+	}
+}
+
+// SetMaxString specifies the length in bytes of the longest string the
+// Decoder will accept.  Longer strings cause DecodeEq and DecodeLGE to return
+// a PkgError with code ErrCorrupt.  The default is 1 MiB.  A Decoder reads
+// each string incrementally, so a corrupt or malicious length never causes it
+// to allocate much more memory than the stream actually contains.
+func (d *Decoder) SetMaxString(n int) {
+	d.maxStr = uint64(max(n, 0))
+}
+
+// corruptError returns a PkgError with code ErrCorrupt.
+func corruptError(format string, a ...any) error {
+	return &PkgError{
+		Code: ErrCorrupt,
+		msg:  fmt.Sprintf(format, a...),
+	}
+}
+
+// readString reads a reference to a string, reading the string itself and
+// adding it to the dictionary if not already present.  It returns the
+// string's dictionary index.  At the end of the stream, readString returns
+// io.EOF.
+func (d *Decoder) readString() (int, error) {
+	ref, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return 0, err
+	}
+	if ref > 0 {
+		if ref > uint64(len(d.dict)) {
+			return 0, corruptError("Invalid dictionary reference %d", ref)
+		}
+		return int(ref - 1), nil
+	}
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	if n > d.maxStr {
+		return 0, corruptError("String length %d exceeds the maximum of %d", n, d.maxStr)
+	}
+	var sb strings.Builder
+	_, err = io.CopyN(&sb, d.r, int64(n))
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	d.dict = append(d.dict, sb.String())
+	d.eqSyms = append(d.eqSyms, 0)
+	d.lgeSyms = append(d.lgeSyms, 0)
+	return len(d.dict) - 1, nil
+}
+
+// unexpectedEOF converts io.EOF to io.ErrUnexpectedEOF and returns all other
+// errors unmodified.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// DecodeEq reads an Eq from the stream.  At the end of the stream, DecodeEq
+// returns io.EOF.
+func (d *Decoder) DecodeEq() (Eq, error) {
+	i, err := d.readString()
+	if err != nil {
+		return 0, err
+	}
+	if gen := eq.gen.Load(); gen != d.eqGen {
+		clear(d.eqSyms)
+		d.eqGen = gen
+	}
+	if d.eqSyms[i] == 0 {
+		sym, err := eq.unmarshal([]byte(d.dict[i]), "Eq", tryNewEqSymbol)
+		if err != nil {
+			return 0, err
+		}
+		d.eqSyms[i] = Eq(sym)
+	}
+	return d.eqSyms[i], nil
+}
+
+// DecodeLGE reads an LGE from the stream.  At the end of the stream,
+// DecodeLGE returns io.EOF.
+func (d *Decoder) DecodeLGE() (LGE, error) {
+	i, err := d.readString()
+	if err != nil {
+		return 0, err
+	}
+	if gen := lge.gen.Load(); gen != d.lgeGen {
+		clear(d.lgeSyms)
+		d.lgeGen = gen
+	}
+	if d.lgeSyms[i] == 0 {
+		sym, err := lge.unmarshal([]byte(d.dict[i]), "LGE", newLGESymbol)
+		if err != nil {
+			return 0, err
+		}
+		d.lgeSyms[i] = LGE(sym)
+	}
+	return d.lgeSyms[i], nil
+}
@@ -0,0 +1,216 @@
+// This file provides unit tests for dictionary-encoded streams of symbols.
+
+package intern_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io"
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/spakin/intern"
+)
+
+// TestStreamEqs encodes a long, repetitive list of Eqs and ensures that it
+// decodes correctly and is much smaller than the equivalent gob.
+func TestStreamEqs(t *testing.T) {
+	// Create a long slice of Eqs with many repeats.
+	intern.ForgetAllEqs()
+	prng := rand.New(rand.NewSource(4556)) // Constant for reproducibility
+	strs := make([]string, 10000)
+	iSyms := make([]intern.Eq, len(strs))
+	for i := range strs {
+		strs[i] = ozChars[prng.Intn(len(ozChars))]
+		iSyms[i] = intern.NewEq(strs[i])
+	}
+
+	// Encode the Eqs.
+	var buf bytes.Buffer
+	enc := intern.NewEncoder(&buf)
+	for _, sym := range iSyms {
+		err := enc.EncodeEq(sym)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := enc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ensure that the encoding is smaller than a gob.
+	var gBuf bytes.Buffer
+	err = gob.NewEncoder(&gBuf).Encode(iSyms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len()*4 > gBuf.Len() {
+		t.Fatalf("Expected the stream (%d bytes) to be much smaller than a gob (%d bytes)", buf.Len(), gBuf.Len())
+	}
+
+	// Forget all Eqs then decode the stream.
+	intern.ForgetAllEqs()
+	dec := intern.NewDecoder(&buf)
+	for i, s := range strs {
+		sym, err := dec.DecodeEq()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sym.String() != s {
+			t.Fatalf("Expected %q but saw %q at index %d", s, sym, i)
+		}
+	}
+	if _, err = dec.DecodeEq(); err != io.EOF {
+		t.Fatalf("Expected io.EOF but saw %v", err)
+	}
+	if n := intern.NumEqs(); n > len(ozChars) {
+		t.Fatalf("Expected at most %d Eqs but saw %d", len(ozChars), n)
+	}
+}
+
+// TestStreamMixed encodes a mixture of Eqs and LGEs with shared strings and
+// ensures that the stream decodes correctly.
+func TestStreamMixed(t *testing.T) {
+	intern.ForgetAllEqs()
+	intern.ForgetAllLGEs()
+	intern.PreLGEMulti(ozChars)
+	lSyms, err := intern.NewLGEMulti(ozChars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eSyms := intern.NewEqMulti(ozChars)
+	var buf bytes.Buffer
+	enc := intern.NewEncoder(&buf)
+	for rep := 0; rep < 2; rep++ {
+		for i := range ozChars {
+			if err = enc.EncodeEq(eSyms[i]); err != nil {
+				t.Fatal(err)
+			}
+			if err = enc.EncodeLGE(lSyms[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err = enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode into fresh tables.
+	intern.ForgetAllEqs()
+	intern.ForgetAllLGEs()
+	intern.PreLGEMulti(ozChars)
+	dec := intern.NewDecoder(&buf)
+	for rep := 0; rep < 2; rep++ {
+		for i, s := range ozChars {
+			eSym, err := dec.DecodeEq()
+			if err != nil {
+				t.Fatal(err)
+			}
+			lSym, err := dec.DecodeLGE()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if eSym.String() != s || lSym.String() != s {
+				t.Fatalf("Expected %q but saw %q and %q at index %d", s, eSym, lSym, i)
+			}
+		}
+	}
+}
+
+// TestStreamInvalid ensures that an Encoder rejects invalid symbols without
+// writing anything.
+func TestStreamInvalid(t *testing.T) {
+	intern.ForgetAllEqs()
+	intern.ForgetAllLGEs()
+	var buf bytes.Buffer
+	enc := intern.NewEncoder(&buf)
+	for _, err := range []error{
+		enc.EncodeEq(0),
+		enc.EncodeEq(intern.Eq(12345)),
+		enc.EncodeLGE(0),
+		enc.EncodeLGE(intern.LGE(12345)),
+	} {
+		if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrInvalid {
+			t.Fatalf("Expected an ErrInvalid error but saw %v", err)
+		}
+	}
+	err := enc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Fatalf("Expected no output but saw %v", buf.Bytes())
+	}
+}
+
+// TestStreamCorrupt ensures that a Decoder rejects invalid input.
+func TestStreamCorrupt(t *testing.T) {
+	for _, b := range [][]byte{
+		{5},          // Reference to a nonexistent entry
+		{0, 10, 'a'}, // Truncated string
+		{0},          // Missing length
+	} {
+		dec := intern.NewDecoder(bytes.NewReader(b))
+		_, err := dec.DecodeEq()
+		if err == nil || err == io.EOF {
+			t.Fatalf("Failed to reject %v (%v)", b, err)
+		}
+	}
+	_, err := intern.NewDecoder(bytes.NewReader([]byte{5})).DecodeEq()
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrCorrupt {
+		t.Fatalf("Expected an ErrCorrupt error but saw %v", err)
+	}
+}
+
+// TestStreamMaxString ensures that a Decoder enforces its maximum string
+// length and does not trust a string's length before reading its contents.
+func TestStreamMaxString(t *testing.T) {
+	// A claimed length just under 1 GiB with no data should fail quickly
+	// with a truncation error instead of allocating the full length.
+	huge := binary.AppendUvarint([]byte{0}, 1<<30-1)
+	dec := intern.NewDecoder(bytes.NewReader(huge))
+	dec.SetMaxString(1 << 30)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := dec.DecodeEq()
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected %v but saw %v", io.ErrUnexpectedEOF, err)
+	}
+	if a := after.TotalAlloc - before.TotalAlloc; a > 1<<20 {
+		t.Fatalf("Decoding a truncated string allocated %d bytes", a)
+	}
+
+	// By default, the same length should be rejected outright.
+	_, err = intern.NewDecoder(bytes.NewReader(huge)).DecodeEq()
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrCorrupt {
+		t.Fatalf("Expected an ErrCorrupt error but saw %v", err)
+	}
+
+	// Strings no longer than the maximum should be accepted.
+	intern.ForgetAllEqs()
+	var buf bytes.Buffer
+	enc := intern.NewEncoder(&buf)
+	for _, str := range []string{"abc", "abcd"} {
+		err = enc.EncodeEq(intern.NewEq(str))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = enc.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dec = intern.NewDecoder(&buf)
+	dec.SetMaxString(3)
+	if sym, err := dec.DecodeEq(); err != nil || sym.String() != "abc" {
+		t.Fatalf("Expected \"abc\" but saw %q (%v)", sym, err)
+	}
+	_, err = dec.DecodeEq()
+	if e, ok := err.(*intern.PkgError); !ok || e.Code != intern.ErrCorrupt {
+		t.Fatalf("Expected an ErrCorrupt error but saw %v", err)
+	}
+}
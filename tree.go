@@ -4,6 +4,7 @@ package intern
 
 import (
 	"fmt"
+	"math/bits"
 	"sort"
 )
 
@@ -11,6 +12,7 @@ import (
 type tree struct {
 	str   string // Contents of this node
 	sym   symbol // Symbol to assign to this string (LTE or LTEC)
+	size  int    // Number of nodes in the subtree rooted at this node
 	left  *tree  // Left child or nil
 	right *tree  // Right child or nil
 }
@@ -26,7 +28,10 @@ func (t *tree) insert(s string) (*tree, symbol, error) {
 // the top-level insert method.
 func (t *tree) insertHelper(s string, val, incr symbol) (*tree, symbol, error) {
 	if t == nil {
-		return &tree{str: s, sym: val}, val, nil
+		return &tree{str: s, sym: val, size: 1}, val, nil
+	}
+	if s == t.str {
+		return t, val, nil
 	}
 	if incr == 0 {
 		e := &PkgError{
@@ -34,24 +39,23 @@ func (t *tree) insertHelper(s string, val, incr symbol) (*tree, symbol, error) {
 			Str:  s,
 			msg:  fmt.Sprintf("Unable to insert %q; symbol table is full", s),
 		}
-		return nil, 0, e
+		return t, 0, e
 	}
 	var sym symbol
 	var err error
-	switch {
-	case s == t.str:
-		sym = val
-	case s < t.str:
+	if s < t.str {
 		t.left, sym, err = t.left.insertHelper(s, val-incr, incr/2)
-	case s > t.str:
+	} else {
 		t.right, sym, err = t.right.insertHelper(s, val+incr, incr/2)
 	}
+	t.resize()
 	return t, sym, err
 }
 
 // insertMany inserts a list of strings into a tree, attempting to maintain
 // balance as it does so.  A new tree, a map from strings to symbols, and an
-// error value are returned.  It is assumed that the given list of strings is
+// error value are returned.  On error, the tree may contain some but not all of
+// the given strings.  It is assumed that the given list of strings is
 // non-empty.
 func (t *tree) insertMany(ss []string) (*tree, map[string]symbol, error) {
 	// Create a sorted version of the list of strings.
@@ -65,7 +69,7 @@ func (t *tree) insertMany(ss []string) (*tree, map[string]symbol, error) {
 	// symbols it returns.
 	tNew, syms, err := t.insertManySorted(sss)
 	if err != nil {
-		return nil, nil, err
+		return tNew, nil, err
 	}
 	sort.Sort(syms)
 	m := make(map[string]symbol, len(sss))
@@ -91,22 +95,332 @@ func (t *tree) insertManySorted(ss []string) (*tree, symbolList, error) {
 	mid := n / 2
 	tNew, sym, err := t.insert(ss[mid])
 	if err != nil {
-		return nil, nil, err
+		return tNew, nil, err
 	}
 	var lSyms, rSyms symbolList
 	if mid > 0 {
 		tNew, lSyms, err = tNew.insertManySorted(ss[:mid])
 		if err != nil {
-			return nil, nil, err
+			return tNew, nil, err
 		}
 	}
 	if mid+1 < n {
 		tNew, rSyms, err = tNew.insertManySorted(ss[mid+1:])
 		if err != nil {
-			return nil, nil, err
+			return tNew, nil, err
 		}
 	}
 	sList := append(lSyms, sym)
 	sList = append(sList, rSyms...)
 	return tNew, sList, nil
 }
+
+// prune removes from a tree each node whose string appears in a given list but
+// not in a given map.  Such nodes are left behind by a failed insertMany.
+// Because a newly inserted node can never be the parent of an existing node,
+// each node is removed along with its entire subtree.  The new tree is
+// returned.
+func (t *tree) prune(ss []string, keep map[string]symbol) *tree {
+	for _, s := range ss {
+		pp := &t
+		var path []*tree
+		for *pp != nil {
+			n := *pp
+			if _, ok := keep[n.str]; !ok {
+				*pp = nil
+				for i := len(path) - 1; i >= 0; i-- {
+					path[i].resize()
+				}
+				break
+			}
+			path = append(path, n)
+			if s == n.str {
+				break
+			}
+			if s < n.str {
+				pp = &n.left
+			} else {
+				pp = &n.right
+			}
+		}
+	}
+	return t
+}
+
+// ascend calls a function on each node whose string is at least lo, in sorted
+// order, until the function returns false.  ascend returns false if the
+// function did.
+func (t *tree) ascend(lo string, f func(*tree) bool) bool {
+	if t == nil {
+		return true
+	}
+	if lo <= t.str {
+		if !t.left.ascend(lo, f) || !f(t) {
+			return false
+		}
+	}
+	return t.right.ascend(lo, f)
+}
+
+// floor returns the node with the greatest string less than or equal to a
+// given string or nil if there is no such node.
+func (t *tree) floor(s string) *tree {
+	var best *tree
+	for n := t; n != nil; {
+		switch {
+		case s == n.str:
+			return n
+		case s < n.str:
+			n = n.left
+		default:
+			best = n
+			n = n.right
+		}
+	}
+	return best
+}
+
+// ceiling returns the node with the least string greater than or equal to a
+// given string or nil if there is no such node.
+func (t *tree) ceiling(s string) *tree {
+	var best *tree
+	for n := t; n != nil; {
+		switch {
+		case s == n.str:
+			return n
+		case s > n.str:
+			n = n.right
+		default:
+			best = n
+			n = n.left
+		}
+	}
+	return best
+}
+
+// next returns the node with the least symbol greater than a given symbol or
+// nil if there is no such node.
+func (t *tree) next(sym symbol) *tree {
+	var best *tree
+	for n := t; n != nil; {
+		if sym < n.sym {
+			best = n
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+	return best
+}
+
+// prev returns the node with the greatest symbol less than a given symbol or
+// nil if there is no such node.
+func (t *tree) prev(sym symbol) *tree {
+	var best *tree
+	for n := t; n != nil; {
+		if sym > n.sym {
+			best = n
+			n = n.right
+		} else {
+			n = n.left
+		}
+	}
+	return best
+}
+
+// rank returns the number of nodes whose symbol is less than a given symbol.
+func (t *tree) rank(sym symbol) int {
+	r := 0
+	for n := t; n != nil; {
+		if sym <= n.sym {
+			n = n.left
+		} else {
+			r += 1 + n.left.count()
+			n = n.right
+		}
+	}
+	return r
+}
+
+// nth returns the node with the k-th smallest string (starting from 0) or nil
+// if k is out of range.
+func (t *tree) nth(k int) *tree {
+	for n := t; n != nil; {
+		nl := n.left.count()
+		switch {
+		case k < nl:
+			n = n.left
+		case k == nl:
+			return n
+		default:
+			k -= nl + 1
+			n = n.right
+		}
+	}
+	return nil
+}
+
+// incrAt returns the increment that insertHelper applies to the children of a
+// node at a given depth.
+func incrAt(depth int) symbol {
+	return symbol(1<<62) >> uint(depth)
+}
+
+// depthOf returns the depth in a tree at which a node with a given symbol
+// must lie.
+func depthOf(sym symbol) int {
+	return 63 - bits.TrailingZeros64(uint64(sym))
+}
+
+// capacityAt returns the maximum number of strings that can be stored in a
+// subtree whose root lies at a given depth.
+func capacityAt(depth int) uint64 {
+	return ^uint64(0) >> uint(depth)
+}
+
+// count returns the number of strings stored in a tree.
+func (t *tree) count() int {
+	if t == nil {
+		return 0
+	}
+	return t.size
+}
+
+// resize recomputes the size of a tree from the sizes of its children.
+func (t *tree) resize() {
+	t.size = 1 + t.left.count() + t.right.count()
+}
+
+// appendStrings appends the strings in a tree to a slice in sorted order and
+// returns the new slice.
+func (t *tree) appendStrings(ss []string) []string {
+	if t == nil {
+		return ss
+	}
+	ss = t.left.appendStrings(ss)
+	ss = append(ss, t.str)
+	return t.right.appendStrings(ss)
+}
+
+// appendNodes appends the nodes in a tree to a slice in sorted order and
+// returns the new slice.
+func (t *tree) appendNodes(ns []*tree) []*tree {
+	if t == nil {
+		return ns
+	}
+	ns = t.left.appendNodes(ns)
+	ns = append(ns, t)
+	return t.right.appendNodes(ns)
+}
+
+// buildBalanced constructs a balanced tree from a sorted list of strings,
+// assigning the given symbol to the root and the given increment to its
+// children.  It is assumed that the strings fit within the tree.
+func buildBalanced(ss []string, val, incr symbol) *tree {
+	if len(ss) == 0 {
+		return nil
+	}
+	mid := len(ss) / 2
+	return &tree{
+		str:   ss[mid],
+		sym:   val,
+		size:  len(ss),
+		left:  buildBalanced(ss[:mid], val-incr, incr/2),
+		right: buildBalanced(ss[mid+1:], val+incr, incr/2),
+	}
+}
+
+// buildKeeping constructs a tree from a sorted list of strings, assigning the
+// given symbol to the root, which lies at the given depth.  Unlike
+// buildBalanced, buildKeeping prefers to leave each string where it was
+// before.  Whenever the string that the given map of old symbols associates
+// with a node's symbol can be placed at that node without overflowing either
+// of the node's subtrees, buildKeeping places it there.  Otherwise, it places
+// the median string there.  It is assumed that the strings fit within the
+// tree.
+func buildKeeping(ss []string, val symbol, depth int, old map[symbol]string) *tree {
+	n := len(ss)
+	if n == 0 {
+		return nil
+	}
+	var childCap uint64
+	if depth < 63 {
+		childCap = capacityAt(depth + 1)
+	}
+	mid := n / 2
+	if str, ok := old[val]; ok {
+		i := sort.SearchStrings(ss, str)
+		if i < n && ss[i] == str && uint64(i) <= childCap && uint64(n-1-i) <= childCap {
+			mid = i
+		}
+	}
+	incr := incrAt(depth)
+	return &tree{
+		str:   ss[mid],
+		sym:   val,
+		size:  n,
+		left:  buildKeeping(ss[:mid], val-incr, depth+1, old),
+		right: buildKeeping(ss[mid+1:], val+incr, depth+1, old),
+	}
+}
+
+// insertRelabel inserts a string into a tree.  If there is no room for the
+// string, insertRelabel rebuilds in balanced form the smallest subtree on the
+// string's insertion path that will be at most half full after the insertion.
+// Only strings within that subtree are assigned new symbols.  insertRelabel
+// returns the new tree, a map from each string that was (re)assigned a symbol
+// to its new symbol, and an error value.
+func (t *tree) insertRelabel(s string) (*tree, map[string]symbol, error) {
+	// In the common case, the string fits without relabeling anything.
+	tNew, sym, err := t.insert(s)
+	if err == nil {
+		return tNew, map[string]symbol{s: sym}, nil
+	}
+
+	// Record the path from the root to the failed insertion point.
+	path := make([]*tree, 0, 64)
+	for n := t; n != nil; {
+		path = append(path, n)
+		if s < n.str {
+			n = n.left
+		} else {
+			n = n.right
+		}
+	}
+
+	// Walk back up the path until we find a subtree with enough room.
+	for d := len(path) - 1; d >= 0; d-- {
+		n := path[d]
+		size := n.count() + 1 // Include the new string.
+		if uint64(size) > capacityAt(d)/2 {
+			continue
+		}
+
+		// Rebuild the subtree rooted at n with s included.
+		ss := n.appendStrings(make([]string, 0, size))
+		i := sort.SearchStrings(ss, s)
+		ss = append(ss, "")
+		copy(ss[i+1:], ss[i:])
+		ss[i] = s
+		sub := buildBalanced(ss, n.sym, incrAt(d))
+		switch {
+		case d == 0:
+			t = sub
+		case s < path[d-1].str:
+			path[d-1].left = sub
+		default:
+			path[d-1].right = sub
+		}
+		for i := d - 1; i >= 0; i-- {
+			path[i].resize()
+		}
+
+		// Report the symbols assigned to every string in the subtree.
+		m := make(map[string]symbol, size)
+		for _, n := range sub.appendNodes(make([]*tree, 0, size)) {
+			m[n.str] = n.sym
+		}
+		return t, m, nil
+	}
+	return t, nil, err
+}